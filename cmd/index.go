@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/quiby-ai/review-rag/config"
+	"github.com/quiby-ai/review-rag/internal/indexer"
+	"github.com/quiby-ai/review-rag/internal/storage"
+)
+
+// runIndex implements the index subcommand, which embeds clean reviews into
+// review_embeddings and exits.
+func runIndex(args []string) {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	appID := flags.String("app", "", "only index reviews of this app")
+	restart := flags.Bool("restart", false, "ignore the saved checkpoint and scan from the first review")
+	batchSize := flags.Int("batch-size", 0, "reviews per embedding request (default index.batch_size)")
+	shadow := flags.Bool("shadow", false, "backfill shadow embeddings of embed.shadow_model instead of review_embeddings")
+	promote := flags.Bool("promote", false, "replace review_embeddings with the complete shadow embeddings of embed.shadow_model")
+	flags.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if *batchSize <= 0 {
+		*batchSize = cfg.Index.BatchSize
+	}
+
+	pool, err := openDatabase(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	repo := storage.NewPostgresRepository(pool)
+	defer repo.Close()
+
+	if *promote {
+		if cfg.Embed.ShadowModel == "" {
+			log.Fatalf("embed.shadow_model must be set to promote shadow embeddings")
+		}
+		promoted, err := repo.PromoteShadowEmbeddings(context.Background(), cfg.Embed.ShadowModel)
+		if err != nil {
+			log.Fatalf("Promotion failed: %v", err)
+		}
+		log.Printf("Promoted %d shadow embeddings of %s into review_embeddings", promoted, cfg.Embed.ShadowModel)
+		return
+	}
+
+	embedCfg := cfg.Embed
+	shadowModel := ""
+	if *shadow {
+		if cfg.Embed.ShadowModel == "" {
+			log.Fatalf("embed.shadow_model must be set to backfill shadow embeddings")
+		}
+		embedCfg = shadowEmbedConfig(cfg.Embed)
+		shadowModel = embedCfg.Model
+	}
+
+	embedClient := newEmbeddingClient(embedCfg)
+
+	// Writing vectors from the wrong model would corrupt the index, so any
+	// mismatch is fatal here whatever embed.on_model_mismatch says. Shadow
+	// vectors are stored per model and need no check.
+	if !*shadow {
+		if err := verifyEmbeddingModel(repo, embedClient, cfg.Embed); err != nil {
+			log.Fatalf("Refusing to index: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ix := indexer.New(repo, withResilience(embedClient, embedCfg), *batchSize)
+	stats, err := ix.Run(ctx, indexer.Options{AppID: *appID, Restart: *restart, ShadowModel: shadowModel})
+	if err != nil {
+		log.Fatalf("Indexing stopped after %d reviews: %v", stats.Indexed, err)
+	}
+
+	log.Printf("Indexing finished: %d reviews in %d batches, %d tokens", stats.Indexed, stats.Batches, stats.Tokens)
+}
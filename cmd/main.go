@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
@@ -9,48 +11,186 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/quiby-ai/review-rag/config"
+	"github.com/quiby-ai/review-rag/db"
 	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/generation"
 	"github.com/quiby-ai/review-rag/internal/handler"
+	"github.com/quiby-ai/review-rag/internal/health"
+	"github.com/quiby-ai/review-rag/internal/metrics"
+	"github.com/quiby-ai/review-rag/internal/migrate"
+	"github.com/quiby-ai/review-rag/internal/rerank"
 	"github.com/quiby-ai/review-rag/internal/service"
 	"github.com/quiby-ai/review-rag/internal/storage"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "index":
+			runIndex(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		}
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	repo, err := storage.NewPostgresRepository(cfg.Database.DSN)
+	pool, err := openDatabase(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
+
+	repo := storage.NewPostgresRepository(pool)
 	defer repo.Close()
 
-	if err := repo.InitRAGTables(context.Background()); err != nil {
-		log.Fatalf("Failed to initialize RAG tables: %v", err)
+	embedClient := newEmbeddingClient(cfg.Embed)
+
+	probeClient := embedClient
+
+	embedClient = withResilience(embedClient, cfg.Embed)
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	if cfg.Embed.CacheTTL > 0 {
+		embedClient = embedding.NewCachedClient(embedClient, repo, cfg.Embed.Model, cfg.Embed.CacheTTL)
+
+		if cfg.Embed.CacheCleanupInterval > 0 {
+			go embedding.RunCacheCleanup(backgroundCtx, repo, cfg.Embed.CacheCleanupInterval)
+		}
 	}
 
-	embedClient := embedding.NewClient(
-		cfg.Embed.Endpoint,
-		cfg.Embed.APIKey,
-		cfg.Embed.Model,
-		cfg.Embed.Timeout,
-	)
+	collector := metrics.NewCollector()
+	if cfg.Server.MetricsRollupInterval > 0 {
+		go collector.RunRollup(backgroundCtx, repo, cfg.Server.MetricsRollupInterval)
+	}
 
-	ragService := service.NewRAGService(embedClient, repo, service.RAGConfig{
-		TopN:          cfg.RAG.TopN,
-		TopK:          cfg.RAG.TopK,
-		ANNProbes:     cfg.RAG.ANNProbes,
-		MinConfidence: cfg.RAG.MinConfidence,
-	})
+	if cfg.Embed.LRUSize > 0 {
+		lru := embedding.NewLRUClient(embedClient, cfg.Embed.LRUSize, cfg.Embed.LRUTTL)
+		collector.RegisterCounterFunc("rag_embedding_lru_hits_total", "Query embeddings served from the in-memory cache.", func() float64 {
+			return float64(lru.Stats().Hits)
+		})
+		collector.RegisterCounterFunc("rag_embedding_lru_misses_total", "Query embeddings not found in the in-memory cache.", func() float64 {
+			return float64(lru.Stats().Misses)
+		})
+		embedClient = lru
+	}
+
+	var generator generation.Generator = generation.NewTemplateGenerator()
+	if cfg.Generate.Provider == "openai" {
+		generator = generation.NewFallbackGenerator(
+			generation.NewOpenAIGenerator(
+				cfg.Generate.Endpoint,
+				cfg.Generate.APIKey,
+				cfg.Generate.Model,
+				cfg.Generate.MaxTokens,
+				cfg.Generate.Temperature,
+				cfg.Generate.Timeout,
+			),
+			generator,
+		)
+	}
+
+	serviceOptions := []service.Option{
+		service.WithMetrics(collector),
+	}
+
+	switch cfg.Rerank.Provider {
+	case "lexical":
+		serviceOptions = append(serviceOptions, service.WithReranker(rerank.NewLexicalReranker()))
+	case "http":
+		serviceOptions = append(serviceOptions, service.WithReranker(rerank.NewHTTPReranker(
+			cfg.Rerank.Endpoint,
+			cfg.Rerank.APIKey,
+			cfg.Rerank.Model,
+			cfg.Rerank.Timeout,
+		)))
+	case "tei":
+		serviceOptions = append(serviceOptions, service.WithReranker(rerank.NewTEIReranker(
+			cfg.Rerank.Endpoint,
+			cfg.Rerank.APIKey,
+			cfg.Rerank.Timeout,
+		)))
+	}
 
-	ragHandler := handler.NewRAGHandler(ragService)
+	if cfg.Embed.ShadowModel != "" {
+		shadowCfg := shadowEmbedConfig(cfg.Embed)
+		shadowClient := withResilience(newEmbeddingClient(shadowCfg), shadowCfg)
+		if cfg.Embed.CacheTTL > 0 {
+			shadowClient = embedding.NewCachedClient(shadowClient, repo, shadowCfg.Model, cfg.Embed.CacheTTL)
+		}
+		serviceOptions = append(serviceOptions, service.WithShadowEmbeddings(shadowClient, shadowCfg.Model))
+	}
+
+	queryLogger := service.NewQueryLogger(repo, cfg.RAG.QueryLogBuffer)
+	defer queryLogger.Close()
+	serviceOptions = append(serviceOptions, service.WithQueryLogger(queryLogger))
+
+	ragService := service.NewRAGService(embedClient, repo, generator, service.RAGConfig{
+		TopN:               cfg.RAG.TopN,
+		TopK:               cfg.RAG.TopK,
+		ANNProbes:          cfg.RAG.ANNProbes,
+		MinConfidence:      cfg.RAG.MinConfidence,
+		RetrievalMode:      cfg.RAG.RetrievalMode,
+		RRFK:               cfg.RAG.RRFK,
+		MMRLambda:          cfg.RAG.MMRLambda,
+		BatchConcurrency:   cfg.RAG.BatchConcurrency,
+		BatchItemTimeout:   cfg.RAG.BatchItemTimeout,
+		SwitchToShadow:     cfg.RAG.SwitchToShadow,
+		ThemeSampleSize:    cfg.RAG.ThemeSampleSize,
+		MaxThemes:          cfg.RAG.MaxThemes,
+		TrendMinSimilarity: cfg.RAG.TrendMinSimilarity,
+		TrendAnomalyZ:      cfg.RAG.TrendAnomalyZ,
+	}, serviceOptions...)
+
+	if cfg.RAG.ShadowCheckInterval > 0 {
+		go ragService.RunShadowSwitch(backgroundCtx, cfg.RAG.ShadowCheckInterval)
+	}
+
+	healthChecker := health.NewChecker(repo, probeClient, collector, version, cfg.Server.EmbeddingProbeTTL)
+
+	if err := verifyEmbeddingModel(repo, probeClient, cfg.Embed); err != nil {
+		var mismatch *health.ModelMismatchError
+		switch {
+		case !errors.As(err, &mismatch) && cfg.Embed.OnModelMismatch == "degrade":
+			log.Printf("Starting degraded, embedding model not verified: %v", err)
+			healthChecker.SetModelCheckError(err)
+			go healthChecker.RetryModelCheck(backgroundCtx, repo, probeClient, cfg.Embed.Model,
+				modelCheckRetryInterval, modelCheckTimeout(cfg.Embed))
+		case !errors.As(err, &mismatch):
+			log.Fatalf("Refusing to start: embedding model check failed: %v", err)
+		case cfg.Embed.OnModelMismatch == "degrade":
+			log.Printf("Starting degraded: %v", err)
+			healthChecker.SetModelMismatch(mismatch)
+		default:
+			log.Fatalf("Refusing to start: %v", err)
+		}
+	}
+
+	ragHandler := handler.NewRAGHandler(ragService, healthChecker)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", ragHandler.HandleRAGQuery)
+	mux.HandleFunc("/query/stream", ragHandler.HandleRAGQueryStream)
+	mux.HandleFunc("/query/batch", ragHandler.HandleRAGQueryBatch)
+	mux.HandleFunc("/query/trend", ragHandler.HandleTrend)
+	mux.HandleFunc("/query/regression", ragHandler.HandleRegression)
+	mux.HandleFunc("/compare", ragHandler.HandleCompare)
+	mux.HandleFunc("/apps/{appId}/themes", ragHandler.HandleThemes)
 	mux.HandleFunc("/healthz", ragHandler.HandleHealthCheck)
+	mux.HandleFunc("/readyz", ragHandler.HandleReadinessCheck)
+	mux.HandleFunc("/embeddings/migration", ragHandler.HandleEmbeddingMigration)
+	mux.Handle("/metrics", collector)
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -82,3 +222,100 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// modelCheckRetryInterval is how often a service that could not verify its
+// embedding model at startup tries again.
+const modelCheckRetryInterval = 30 * time.Second
+
+func modelCheckTimeout(cfg config.EmbedConfig) time.Duration {
+	return cfg.Timeout + 5*time.Second
+}
+
+func verifyEmbeddingModel(repo storage.Repository, client embedding.Client, cfg config.EmbedConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), modelCheckTimeout(cfg))
+	defer cancel()
+
+	return health.VerifyEmbeddingModel(ctx, repo, client, cfg.Model)
+}
+
+// openDatabase connects to Postgres and, with database.auto_migrate, applies
+// pending migrations. Otherwise it only warns about them.
+func openDatabase(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
+	ctx := context.Background()
+
+	pool, err := storage.NewPool(ctx, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := migrate.Load(migrationFiles())
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	migrator := migrate.New(pool, migrations)
+
+	if cfg.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s", m.Version, m.Name)
+		}
+		return pool, nil
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			log.Printf("Migration %d_%s is pending; run the migrate up subcommand", status.Version, status.Name)
+		}
+	}
+
+	return pool, nil
+}
+
+func migrationFiles() fs.FS {
+	files, err := fs.Sub(db.Migrations, "migrations")
+	if err != nil {
+		log.Fatalf("Failed to open embedded migrations: %v", err)
+	}
+	return files
+}
+
+func newEmbeddingClient(cfg config.EmbedConfig) embedding.Client {
+	switch cfg.Provider {
+	case "azure":
+		return embedding.NewAzureClient(cfg.Endpoint, cfg.APIKey, cfg.Deployment, cfg.APIVersion, cfg.Timeout)
+	case "ollama":
+		return embedding.NewOllamaClient(cfg.Endpoint, cfg.Model, cfg.Timeout)
+	case "tei":
+		return embedding.NewTEIClient(cfg.Endpoint, cfg.APIKey, cfg.Timeout)
+	default:
+		return embedding.NewClient(cfg.Endpoint, cfg.APIKey, cfg.Model, cfg.Timeout)
+	}
+}
+
+// shadowEmbedConfig is cfg with the shadow model in place of the primary
+// one. On Azure the deployment is expected to be named after the model.
+func shadowEmbedConfig(cfg config.EmbedConfig) config.EmbedConfig {
+	cfg.Model = cfg.ShadowModel
+	cfg.Deployment = cfg.ShadowModel
+	return cfg
+}
+
+func withResilience(client embedding.Client, cfg config.EmbedConfig) embedding.Client {
+	return embedding.NewResilientClient(client, embedding.ResilienceConfig{
+		MaxRetries:     cfg.MaxRetries,
+		BaseDelay:      cfg.RetryBaseDelay,
+		MaxDelay:       cfg.RetryMaxDelay,
+		FailureLimit:   cfg.BreakerFailures,
+		BreakerTimeout: cfg.BreakerTimeout,
+	})
+}
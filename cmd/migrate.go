@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/quiby-ai/review-rag/config"
+	"github.com/quiby-ai/review-rag/internal/migrate"
+	"github.com/quiby-ai/review-rag/internal/storage"
+)
+
+const migrateUsage = "usage: migrate up | down [-steps N] | status"
+
+// runMigrate implements the migrate subcommand, which manages the schema
+// explicitly instead of at server startup.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	flags.Parse(args[1:])
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := storage.NewPool(ctx, cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer pool.Close()
+
+	migrations, err := migrate.Load(migrationFiles())
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	migrator := migrate.New(pool, migrations)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("Schema is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		printMigrationStatus(statuses)
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+func printMigrationStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	w.Flush()
+}
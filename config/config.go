@@ -11,34 +11,87 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Embed    EmbedConfig
+	Generate GenerateConfig
+	Rerank   RerankConfig
 	RAG      RAGConfig
+	Index    IndexConfig
 }
 
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	Port                  string
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	IdleTimeout           time.Duration
+	MetricsRollupInterval time.Duration
+	EmbeddingProbeTTL     time.Duration
 }
 
 type DatabaseConfig struct {
-	DSN string
+	DSN         string
+	AutoMigrate bool
 }
 
 type EmbedConfig struct {
+	Provider             string
+	Model                string
+	Endpoint             string
+	APIKey               string
+	Deployment           string
+	APIVersion           string
+	Timeout              time.Duration
+	CacheTTL             time.Duration
+	CacheCleanupInterval time.Duration
+	LRUSize              int
+	LRUTTL               time.Duration
+	MaxRetries           int
+	RetryBaseDelay       time.Duration
+	RetryMaxDelay        time.Duration
+	BreakerFailures      int
+	BreakerTimeout       time.Duration
+	OnModelMismatch      string
+	ShadowModel          string
+}
+
+type GenerateConfig struct {
+	Provider    string
+	Model       string
+	Endpoint    string
+	APIKey      string
+	Timeout     time.Duration
+	MaxTokens   int
+	Temperature float64
+}
+
+type RerankConfig struct {
+	Provider string
 	Model    string
 	Endpoint string
 	APIKey   string
 	Timeout  time.Duration
-	CacheTTL time.Duration
 }
 
 type RAGConfig struct {
-	TopN           int
-	TopK           int
-	ANNProbes      int
-	MinConfidence  float64
-	MaxQueryLength int
+	TopN                int
+	TopK                int
+	ANNProbes           int
+	MinConfidence       float64
+	MaxQueryLength      int
+	QueryLogBuffer      int
+	RetrievalMode       string
+	RRFK                int
+	MMRLambda           float64
+	BatchConcurrency    int
+	BatchItemTimeout    time.Duration
+	SwitchToShadow      bool
+	ShadowCheckInterval time.Duration
+	ThemeSampleSize     int
+	MaxThemes           int
+	TrendMinSimilarity  float64
+	TrendAnomalyZ       float64
+}
+
+type IndexConfig struct {
+	BatchSize int
 }
 
 func Load() (*Config, error) {
@@ -50,6 +103,8 @@ func Load() (*Config, error) {
 
 	viper.BindEnv("PG_DSN")
 	viper.BindEnv("OPENAI_API_KEY")
+	viper.BindEnv("EMBED_API_KEY")
+	viper.BindEnv("RERANK_API_KEY")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -57,27 +112,74 @@ func Load() (*Config, error) {
 
 	config := &Config{
 		Server: ServerConfig{
-			Port:         viper.GetString("server.port"),
-			ReadTimeout:  viper.GetDuration("server.read_timeout_seconds"),
-			WriteTimeout: viper.GetDuration("server.write_timeout_seconds"),
-			IdleTimeout:  viper.GetDuration("server.idle_timeout_seconds"),
+			Port:                  viper.GetString("server.port"),
+			ReadTimeout:           viper.GetDuration("server.read_timeout_seconds"),
+			WriteTimeout:          viper.GetDuration("server.write_timeout_seconds"),
+			IdleTimeout:           viper.GetDuration("server.idle_timeout_seconds"),
+			MetricsRollupInterval: viper.GetDuration("server.metrics_rollup_interval_seconds"),
+			EmbeddingProbeTTL:     viper.GetDuration("server.embedding_probe_ttl_seconds"),
 		},
 		Database: DatabaseConfig{
-			DSN: viper.GetString("PG_DSN"),
+			DSN:         viper.GetString("PG_DSN"),
+			AutoMigrate: viper.GetBool("database.auto_migrate"),
 		},
 		Embed: EmbedConfig{
-			Model:    viper.GetString("embed.model"),
-			Endpoint: viper.GetString("embed.endpoint"),
-			APIKey:   viper.GetString("OPENAI_API_KEY"),
-			Timeout:  viper.GetDuration("embed.timeout_seconds"),
-			CacheTTL: viper.GetDuration("embed.cache_ttl_seconds"),
+			Provider:             viper.GetString("embed.provider"),
+			Model:                viper.GetString("embed.model"),
+			Endpoint:             viper.GetString("embed.endpoint"),
+			APIKey:               viper.GetString("EMBED_API_KEY"),
+			Deployment:           viper.GetString("embed.deployment"),
+			APIVersion:           viper.GetString("embed.api_version"),
+			Timeout:              viper.GetDuration("embed.timeout_seconds"),
+			CacheTTL:             viper.GetDuration("embed.cache_ttl_seconds"),
+			CacheCleanupInterval: viper.GetDuration("embed.cache_cleanup_interval_seconds"),
+			LRUSize:              viper.GetInt("embed.lru_size"),
+			LRUTTL:               viper.GetDuration("embed.lru_ttl_seconds"),
+			MaxRetries:           viper.GetInt("embed.max_retries"),
+			RetryBaseDelay:       viper.GetDuration("embed.retry_base_delay_seconds"),
+			RetryMaxDelay:        viper.GetDuration("embed.retry_max_delay_seconds"),
+			BreakerFailures:      viper.GetInt("embed.breaker_failures"),
+			BreakerTimeout:       viper.GetDuration("embed.breaker_timeout_seconds"),
+			OnModelMismatch:      viper.GetString("embed.on_model_mismatch"),
+			ShadowModel:          viper.GetString("embed.shadow_model"),
+		},
+		Generate: GenerateConfig{
+			Provider:    viper.GetString("generate.provider"),
+			Model:       viper.GetString("generate.model"),
+			Endpoint:    viper.GetString("generate.endpoint"),
+			APIKey:      viper.GetString("OPENAI_API_KEY"),
+			Timeout:     viper.GetDuration("generate.timeout_seconds"),
+			MaxTokens:   viper.GetInt("generate.max_tokens"),
+			Temperature: viper.GetFloat64("generate.temperature"),
+		},
+		Rerank: RerankConfig{
+			Provider: viper.GetString("rerank.provider"),
+			Model:    viper.GetString("rerank.model"),
+			Endpoint: viper.GetString("rerank.endpoint"),
+			APIKey:   viper.GetString("RERANK_API_KEY"),
+			Timeout:  viper.GetDuration("rerank.timeout_seconds"),
 		},
 		RAG: RAGConfig{
-			TopN:           viper.GetInt("rag.top_n"),
-			TopK:           viper.GetInt("rag.top_k"),
-			ANNProbes:      viper.GetInt("rag.ann_probes"),
-			MinConfidence:  viper.GetFloat64("rag.min_confidence"),
-			MaxQueryLength: viper.GetInt("rag.max_query_length"),
+			TopN:                viper.GetInt("rag.top_n"),
+			TopK:                viper.GetInt("rag.top_k"),
+			ANNProbes:           viper.GetInt("rag.ann_probes"),
+			MinConfidence:       viper.GetFloat64("rag.min_confidence"),
+			MaxQueryLength:      viper.GetInt("rag.max_query_length"),
+			QueryLogBuffer:      viper.GetInt("rag.query_log_buffer"),
+			RetrievalMode:       viper.GetString("rag.retrieval_mode"),
+			RRFK:                viper.GetInt("rag.rrf_k"),
+			MMRLambda:           viper.GetFloat64("rag.mmr_lambda"),
+			BatchConcurrency:    viper.GetInt("rag.batch_concurrency"),
+			BatchItemTimeout:    viper.GetDuration("rag.batch_item_timeout_seconds"),
+			SwitchToShadow:      viper.GetBool("rag.switch_to_shadow"),
+			ShadowCheckInterval: viper.GetDuration("rag.shadow_check_interval_seconds"),
+			ThemeSampleSize:     viper.GetInt("rag.theme_sample_size"),
+			MaxThemes:           viper.GetInt("rag.max_themes"),
+			TrendMinSimilarity:  viper.GetFloat64("rag.trend_min_similarity"),
+			TrendAnomalyZ:       viper.GetFloat64("rag.trend_anomaly_z"),
+		},
+		Index: IndexConfig{
+			BatchSize: viper.GetInt("index.batch_size"),
 		},
 	}
 
@@ -86,7 +188,49 @@ func Load() (*Config, error) {
 	}
 
 	if config.Embed.APIKey == "" {
-		return nil, fmt.Errorf("EMBED_API_KEY environment variable is required")
+		config.Embed.APIKey = viper.GetString("OPENAI_API_KEY")
+	}
+
+	switch config.Embed.Provider {
+	case "", "openai", "azure":
+		if config.Embed.APIKey == "" {
+			return nil, fmt.Errorf("EMBED_API_KEY environment variable is required")
+		}
+	case "ollama", "tei":
+	default:
+		return nil, fmt.Errorf("unknown embed.provider %q", config.Embed.Provider)
+	}
+
+	if config.Embed.Provider == "azure" && config.Embed.APIVersion == "" {
+		return nil, fmt.Errorf("embed.api_version is required for the azure provider")
+	}
+
+	switch config.Embed.OnModelMismatch {
+	case "", "fail", "degrade":
+	default:
+		return nil, fmt.Errorf("unknown embed.on_model_mismatch %q", config.Embed.OnModelMismatch)
+	}
+
+	if config.Embed.Deployment == "" {
+		config.Embed.Deployment = config.Embed.Model
+	}
+
+	switch config.Generate.Provider {
+	case "", "template", "openai":
+	default:
+		return nil, fmt.Errorf("unknown generate.provider %q", config.Generate.Provider)
+	}
+
+	switch config.Rerank.Provider {
+	case "", "none", "lexical", "http", "tei":
+	default:
+		return nil, fmt.Errorf("unknown rerank.provider %q", config.Rerank.Provider)
+	}
+
+	switch config.RAG.RetrievalMode {
+	case "", "vector", "hybrid":
+	default:
+		return nil, fmt.Errorf("unknown rag.retrieval_mode %q", config.RAG.RetrievalMode)
 	}
 
 	return config, nil
@@ -0,0 +1,10 @@
+// Package db embeds the SQL schema migrations into the binary.
+package db
+
+import "embed"
+
+// Migrations holds NNN_name.sql files that apply a schema change and
+// NNN_name.down.sql files that revert it.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
@@ -0,0 +1,8 @@
+DROP FUNCTION IF EXISTS update_rag_metrics(VARCHAR, DECIMAL, VARCHAR);
+DROP FUNCTION IF EXISTS cleanup_expired_embeddings();
+
+DROP TABLE IF EXISTS rag_metrics;
+DROP TABLE IF EXISTS embedding_cache;
+DROP TABLE IF EXISTS rag_query_logs;
+
+DROP INDEX IF EXISTS idx_review_embeddings_hnsw;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_rag_query_logs_last_seen_at;
+
+ALTER TABLE rag_query_logs DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE rag_query_logs DROP COLUMN IF EXISTS hit_count;
@@ -0,0 +1,4 @@
+ALTER TABLE rag_query_logs ADD COLUMN IF NOT EXISTS hit_count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE rag_query_logs ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_rag_query_logs_last_seen_at ON rag_query_logs(last_seen_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_clean_reviews_fts;
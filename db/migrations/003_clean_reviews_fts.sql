@@ -0,0 +1,3 @@
+-- Full-text index used by hybrid retrieval. The expression must match the
+-- one queried in KeywordRetrieval.
+CREATE INDEX IF NOT EXISTS idx_clean_reviews_fts ON clean_reviews USING gin (to_tsvector('english', COALESCE(title, '') || ' ' || COALESCE(content_clean, '')));
@@ -0,0 +1,8 @@
+-- Model and dimension that produced the vectors in each embedding table,
+-- checked at startup so a model swap is noticed before queries fail.
+CREATE TABLE IF NOT EXISTS embedding_models (
+    table_name VARCHAR(100) PRIMARY KEY,
+    model_name VARCHAR(100) NOT NULL,
+    dimensions INTEGER NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
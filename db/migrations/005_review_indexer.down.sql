@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS index_checkpoints;
+
+DROP INDEX IF EXISTS idx_review_embeddings_review_id_unique;
+
+ALTER TABLE review_embeddings DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,50 @@
+-- Support for the index subcommand: the hash of the content each embedding
+-- was built from, so changed reviews are re-embedded, a unique key to upsert
+-- on, and resumable checkpoints.
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+
+-- Embeddings written before this migration are taken to be built from the
+-- reviews' current content, so the first index run does not re-embed every
+-- review. The expression must match indexedContent in internal/storage. To
+-- re-embed everything instead, set content_hash to NULL and run index.
+UPDATE review_embeddings re
+SET content_hash = encode(sha256(convert_to(COALESCE(NULLIF(cr.content_en, ''), cr.content_clean), 'UTF8')), 'hex')
+FROM clean_reviews cr
+WHERE cr.id = re.review_id AND re.content_hash IS NULL;
+
+-- Keep one embedding per review so the unique index can be built. The
+-- table is created outside these migrations, so the newest row is chosen by
+-- whichever of updated_at, created_at and id it has; physical row order only
+-- breaks the ties those leave.
+DO $$
+DECLARE
+    order_by TEXT := '';
+    col TEXT;
+BEGIN
+    FOREACH col IN ARRAY ARRAY['updated_at', 'created_at', 'id'] LOOP
+        IF EXISTS (
+            SELECT 1 FROM pg_attribute
+            WHERE attrelid = 'review_embeddings'::regclass AND attname = col AND NOT attisdropped
+        ) THEN
+            order_by := order_by || format('%I DESC NULLS LAST, ', col);
+        END IF;
+    END LOOP;
+
+    EXECUTE format($sql$
+        DELETE FROM review_embeddings re
+        USING (
+            SELECT ctid, ROW_NUMBER() OVER (PARTITION BY review_id ORDER BY %s ctid DESC) AS position
+            FROM review_embeddings
+        ) ranked
+        WHERE re.ctid = ranked.ctid AND ranked.position > 1;
+    $sql$, order_by);
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_review_embeddings_review_id_unique ON review_embeddings(review_id);
+
+CREATE TABLE IF NOT EXISTS index_checkpoints (
+    name VARCHAR(255) PRIMARY KEY,
+    last_review_id TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
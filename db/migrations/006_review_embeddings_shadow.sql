@@ -0,0 +1,14 @@
+-- Embeddings of a model being migrated to, kept next to review_embeddings
+-- until retrieval switches over. The vector column has no fixed dimension so
+-- any model fits; it therefore has no ANN index.
+CREATE TABLE IF NOT EXISTS review_embeddings_shadow (
+    review_id TEXT NOT NULL,
+    model_name VARCHAR(100) NOT NULL,
+    app_id VARCHAR(255) NOT NULL,
+    content_vec vector NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (review_id, model_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_embeddings_shadow_model_app_id ON review_embeddings_shadow(model_name, app_id);
@@ -0,0 +1,13 @@
+-- Cached entries can be recomputed, so any that do not fit the original
+-- schema are dropped: other dimensions, and all but the newest entry per text.
+DROP INDEX IF EXISTS idx_embedding_cache_text_hash_model;
+
+DELETE FROM embedding_cache WHERE vector_dims(embedding_vector) <> 1536;
+
+DELETE FROM embedding_cache a
+USING embedding_cache b
+WHERE a.text_hash = b.text_hash AND (a.created_at, a.id) < (b.created_at, b.id);
+
+ALTER TABLE embedding_cache ALTER COLUMN embedding_vector TYPE vector(1536);
+
+ALTER TABLE embedding_cache ADD CONSTRAINT embedding_cache_text_hash_key UNIQUE (text_hash);
@@ -0,0 +1,9 @@
+-- The embedding cache holds vectors of every model in use, e.g. the primary
+-- and the shadow model during a migration. Entries are keyed per model so
+-- the models do not overwrite each other, and the vector column has no
+-- fixed dimension so any model fits.
+ALTER TABLE embedding_cache DROP CONSTRAINT IF EXISTS embedding_cache_text_hash_key;
+
+ALTER TABLE embedding_cache ALTER COLUMN embedding_vector TYPE vector;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_embedding_cache_text_hash_model ON embedding_cache(text_hash, model_name);
@@ -0,0 +1,207 @@
+// Package clustering groups review embeddings into themes.
+package clustering
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// seed makes clustering reproducible: the same reviews give the same themes.
+const seed = 42
+
+// Cluster is a group of input vectors. Members are indexes into the input,
+// closest to the centroid first.
+type Cluster struct {
+	Centroid []float32
+	Members  []int
+}
+
+// DefaultK is the rule-of-thumb cluster count sqrt(n/2), kept between 2
+// and maxK.
+func DefaultK(n, maxK int) int {
+	k := int(math.Round(math.Sqrt(float64(n) / 2)))
+	return max(2, min(k, maxK))
+}
+
+// KMeans partitions vectors into at most k clusters by cosine similarity
+// (spherical k-means), seeded with k-means++. It stops once no vector
+// changes cluster or after maxIterations. Empty clusters are dropped and the
+// rest are returned largest first.
+func KMeans(vectors [][]float32, k, maxIterations int) []Cluster {
+	if len(vectors) == 0 || k <= 0 {
+		return nil
+	}
+	k = min(k, len(vectors))
+
+	points := make([][]float64, len(vectors))
+	for i, vector := range vectors {
+		points[i] = normalize(vector)
+	}
+
+	rng := rand.New(rand.NewPCG(seed, uint64(len(points))))
+	centroids := initialCentroids(points, k, rng)
+
+	assignments := make([]int, len(points))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+
+	for iteration := 0; iteration < max(1, maxIterations); iteration++ {
+		changed := false
+		for i, point := range points {
+			best := nearest(point, centroids)
+			if best != assignments[i] {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		centroids = updateCentroids(points, assignments, centroids)
+	}
+
+	return collect(points, assignments, centroids)
+}
+
+// initialCentroids picks k-means++ seeds: each next seed is drawn with
+// probability proportional to its squared distance from the closest seed
+// so far.
+func initialCentroids(points [][]float64, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{points[rng.IntN(len(points))]}
+	distances := make([]float64, len(points))
+
+	for len(centroids) < k {
+		var total float64
+		for i, point := range points {
+			d := distance(point, centroids[nearest(point, centroids)])
+			distances[i] = d * d
+			total += distances[i]
+		}
+
+		// Every point coincides with a seed; no further distinct seed exists.
+		if total == 0 {
+			break
+		}
+
+		target := rng.Float64() * total
+		next := len(points) - 1
+		for i, d := range distances {
+			target -= d
+			if target <= 0 {
+				next = i
+				break
+			}
+		}
+		centroids = append(centroids, points[next])
+	}
+
+	return centroids
+}
+
+// updateCentroids returns the normalised mean of each cluster. A cluster
+// that lost all its points keeps its previous centroid.
+func updateCentroids(points [][]float64, assignments []int, previous [][]float64) [][]float64 {
+	dimensions := len(points[0])
+	sums := make([][]float64, len(previous))
+	counts := make([]int, len(previous))
+	for c := range sums {
+		sums[c] = make([]float64, dimensions)
+	}
+
+	for i, point := range points {
+		c := assignments[i]
+		counts[c]++
+		for d, value := range point {
+			sums[c][d] += value
+		}
+	}
+
+	centroids := make([][]float64, len(previous))
+	for c := range sums {
+		if counts[c] == 0 {
+			centroids[c] = previous[c]
+			continue
+		}
+		centroids[c] = normalizeFloat64(sums[c])
+	}
+
+	return centroids
+}
+
+func collect(points [][]float64, assignments []int, centroids [][]float64) []Cluster {
+	members := make([][]int, len(centroids))
+	for i, c := range assignments {
+		members[c] = append(members[c], i)
+	}
+
+	var clusters []Cluster
+	for c, indexes := range members {
+		if len(indexes) == 0 {
+			continue
+		}
+
+		centroid := centroids[c]
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return dot(points[indexes[a]], centroid) > dot(points[indexes[b]], centroid)
+		})
+
+		vector := make([]float32, len(centroid))
+		for d, value := range centroid {
+			vector[d] = float32(value)
+		}
+		clusters = append(clusters, Cluster{Centroid: vector, Members: indexes})
+	}
+
+	sort.SliceStable(clusters, func(a, b int) bool {
+		return len(clusters[a].Members) > len(clusters[b].Members)
+	})
+
+	return clusters
+}
+
+// nearest returns the index of the centroid most similar to point.
+func nearest(point []float64, centroids [][]float64) int {
+	best := 0
+	bestSimilarity := math.Inf(-1)
+	for c, centroid := range centroids {
+		if similarity := dot(point, centroid); similarity > bestSimilarity {
+			best = c
+			bestSimilarity = similarity
+		}
+	}
+	return best
+}
+
+// distance is the cosine distance between two unit vectors.
+func distance(a, b []float64) float64 {
+	return math.Max(0, 1-dot(a, b))
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func normalize(vector []float32) []float64 {
+	values := make([]float64, len(vector))
+	for i, value := range vector {
+		values[i] = float64(value)
+	}
+	return normalizeFloat64(values)
+}
+
+func normalizeFloat64(values []float64) []float64 {
+	norm := math.Sqrt(dot(values, values))
+	if norm == 0 {
+		return values
+	}
+	for i := range values {
+		values[i] /= norm
+	}
+	return values
+}
@@ -0,0 +1,43 @@
+package clustering
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKMeans_SeparatesThemes(t *testing.T) {
+	vectors := [][]float32{
+		{1, 0.1, 0},
+		{0, 1, 0.1},
+		{0.9, 0, 0.1},
+		{0.1, 0.9, 0},
+		{1, 0, 0},
+		{0, 0.1, 1},
+	}
+
+	clusters := KMeans(vectors, 3, 20)
+
+	assert.Len(t, clusters, 3)
+	assert.ElementsMatch(t, []int{0, 2, 4}, clusters[0].Members)
+	assert.Equal(t, 4, clusters[0].Members[0], "the review closest to the centroid comes first")
+	assert.ElementsMatch(t, []int{1, 3}, clusters[1].Members)
+	assert.Equal(t, []int{5}, clusters[2].Members)
+	assert.Equal(t, clusters, KMeans(vectors, 3, 20), "clustering is reproducible")
+}
+
+func TestKMeans_MoreClustersThanDistinctVectors(t *testing.T) {
+	vectors := [][]float32{{1, 0}, {1, 0}, {2, 0}}
+
+	clusters := KMeans(vectors, 3, 20)
+
+	assert.Len(t, clusters, 1)
+	assert.Len(t, clusters[0].Members, 3)
+	assert.Nil(t, KMeans(nil, 3, 20))
+}
+
+func TestDefaultK(t *testing.T) {
+	assert.Equal(t, 2, DefaultK(3, 10))
+	assert.Equal(t, 7, DefaultK(100, 10))
+	assert.Equal(t, 10, DefaultK(5000, 10))
+}
@@ -0,0 +1,134 @@
+package embedding
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const cacheWriteTimeout = 5 * time.Second
+
+// Cache persists embeddings keyed by text hash and model name.
+// GetCachedEmbeddings returns the fresh entries among textHashes, keyed by
+// hash; hashes without one are absent from the map.
+type Cache interface {
+	GetCachedEmbeddings(ctx context.Context, textHashes []string, model string) (map[string][]float32, error)
+	StoreCachedEmbedding(ctx context.Context, textHash, text, model string, embedding []float32, expiresAt time.Time) error
+	CleanupExpiredEmbeddings(ctx context.Context) error
+}
+
+type cachedClient struct {
+	Client
+	cache Cache
+	model string
+	ttl   time.Duration
+}
+
+// NewCachedClient wraps next so that embeddings are served from cache when a
+// fresh entry exists and written back after every miss. Cache failures are
+// logged and never fail the request.
+func NewCachedClient(next Client, cache Cache, model string, ttl time.Duration) Client {
+	return &cachedClient{
+		Client: next,
+		cache:  cache,
+		model:  model,
+		ttl:    ttl,
+	}
+}
+
+func (c *cachedClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	hash := c.GetQueryHash(text)
+
+	cached, err := c.cache.GetCachedEmbeddings(ctx, []string{hash}, c.model)
+	if err != nil {
+		log.Printf("Embedding cache lookup failed: %v", err)
+	} else if embedding, ok := cached[hash]; ok {
+		return embedding, nil
+	}
+
+	embedding, err := c.Client.GenerateEmbedding(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store([]string{text}, [][]float32{embedding})
+
+	return embedding, nil
+}
+
+// GenerateEmbeddings looks up all texts in the cache at once and embeds only
+// the misses, in a single call to the wrapped client.
+func (c *cachedClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	result := &Batch{Embeddings: make([][]float32, len(texts))}
+	var missTexts []string
+	var missIndexes []int
+
+	hashes := make([]string, len(texts))
+	for i, text := range texts {
+		hashes[i] = c.GetQueryHash(text)
+	}
+
+	cached, err := c.cache.GetCachedEmbeddings(ctx, hashes, c.model)
+	if err != nil {
+		log.Printf("Embedding cache lookup failed: %v", err)
+	}
+
+	for i, text := range texts {
+		if embedding, ok := cached[hashes[i]]; ok {
+			result.Embeddings[i] = embedding
+			continue
+		}
+		missTexts = append(missTexts, text)
+		missIndexes = append(missIndexes, i)
+	}
+
+	if len(missTexts) > 0 {
+		batch, err := c.Client.GenerateEmbeddings(ctx, missTexts)
+		if err != nil {
+			return nil, err
+		}
+
+		result.PromptTokens = batch.PromptTokens
+		result.TotalTokens = batch.TotalTokens
+
+		for j, i := range missIndexes {
+			result.Embeddings[i] = batch.Embeddings[j]
+		}
+
+		c.store(missTexts, batch.Embeddings)
+	}
+
+	return result, nil
+}
+
+// store writes embeddings back in the background so callers never wait on it.
+func (c *cachedClient) store(texts []string, embeddings [][]float32) {
+	expiresAt := time.Now().Add(c.ttl)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cacheWriteTimeout)
+		defer cancel()
+
+		for i, text := range texts {
+			if err := c.cache.StoreCachedEmbedding(ctx, c.GetQueryHash(text), text, c.model, embeddings[i], expiresAt); err != nil {
+				log.Printf("Embedding cache write failed: %v", err)
+			}
+		}
+	}()
+}
+
+// RunCacheCleanup removes expired cache entries every interval until ctx is done.
+func RunCacheCleanup(ctx context.Context, cache Cache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cache.CleanupExpiredEmbeddings(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Embedding cache cleanup failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubClient struct {
+	mu      sync.Mutex
+	calls   int
+	batches [][]string
+	vec     []float32
+	err     error
+}
+
+func (c *stubClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.vec, c.err
+}
+
+func (c *stubClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	c.batches = append(c.batches, texts)
+	if c.err != nil {
+		return nil, c.err
+	}
+	embeddings := make([][]float32, len(texts))
+	for i := range texts {
+		embeddings[i] = c.vec
+	}
+	return &Batch{Embeddings: embeddings}, nil
+}
+
+func (c *stubClient) GetQueryHash(text string) string {
+	return "hash:" + text
+}
+
+func (c *stubClient) callCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+type cacheEntry struct {
+	vec       []float32
+	model     string
+	expiresAt time.Time
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	stored  chan struct{}
+	lookups int
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		entries: make(map[string]cacheEntry),
+		stored:  make(chan struct{}, 10),
+	}
+}
+
+func (c *memoryCache) GetCachedEmbeddings(ctx context.Context, textHashes []string, model string) (map[string][]float32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	cached := make(map[string][]float32)
+	for _, textHash := range textHashes {
+		entry, ok := c.entries[textHash]
+		if ok && entry.model == model && entry.expiresAt.After(time.Now()) {
+			cached[textHash] = entry.vec
+		}
+	}
+	return cached, nil
+}
+
+func (c *memoryCache) StoreCachedEmbedding(ctx context.Context, textHash, text, model string, embedding []float32, expiresAt time.Time) error {
+	c.mu.Lock()
+	c.entries[textHash] = cacheEntry{vec: embedding, model: model, expiresAt: expiresAt}
+	c.mu.Unlock()
+	c.stored <- struct{}{}
+	return nil
+}
+
+func (c *memoryCache) CleanupExpiredEmbeddings(ctx context.Context) error {
+	return nil
+}
+
+func waitStored(t *testing.T, cache *memoryCache) {
+	select {
+	case <-cache.stored:
+	case <-time.After(time.Second):
+		t.Fatal("embedding was not written back to the cache")
+	}
+}
+
+func TestCachedClient_MissThenHit(t *testing.T) {
+	inner := &stubClient{vec: []float32{0.1, 0.2}}
+	cache := newMemoryCache()
+	client := NewCachedClient(inner, cache, "model-a", time.Hour)
+
+	first, err := client.GenerateEmbedding(context.Background(), "login fails")
+	require.NoError(t, err)
+	waitStored(t, cache)
+
+	second, err := client.GenerateEmbedding(context.Background(), "login fails")
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, inner.callCount())
+}
+
+func TestCachedClient_RespectsModelAndExpiry(t *testing.T) {
+	inner := &stubClient{vec: []float32{0.3}}
+	cache := newMemoryCache()
+	cache.entries["hash:expired"] = cacheEntry{vec: []float32{9}, model: "model-a", expiresAt: time.Now().Add(-time.Minute)}
+	cache.entries["hash:other-model"] = cacheEntry{vec: []float32{9}, model: "model-b", expiresAt: time.Now().Add(time.Hour)}
+	client := NewCachedClient(inner, cache, "model-a", time.Hour)
+
+	vec, err := client.GenerateEmbedding(context.Background(), "expired")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.3}, vec)
+	waitStored(t, cache)
+
+	vec, err = client.GenerateEmbedding(context.Background(), "other-model")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.3}, vec)
+	waitStored(t, cache)
+
+	assert.Equal(t, 2, inner.callCount())
+}
+
+func TestCachedClient_GenerateEmbeddingsOnlyEmbedsMisses(t *testing.T) {
+	inner := &stubClient{vec: []float32{0.5}}
+	cache := newMemoryCache()
+	cache.entries["hash:cached"] = cacheEntry{vec: []float32{9}, model: "model-a", expiresAt: time.Now().Add(time.Hour)}
+	client := NewCachedClient(inner, cache, "model-a", time.Hour)
+
+	batch, err := client.GenerateEmbeddings(context.Background(), []string{"first", "cached", "second"})
+	require.NoError(t, err)
+	waitStored(t, cache)
+	waitStored(t, cache)
+
+	assert.Equal(t, [][]float32{{0.5}, {9}, {0.5}}, batch.Embeddings)
+	assert.Equal(t, [][]string{{"first", "second"}}, inner.batches)
+	assert.Equal(t, 1, cache.lookups, "the cache is queried once per batch")
+}
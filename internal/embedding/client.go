@@ -8,21 +8,48 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/quiby-ai/review-rag/internal/types"
 )
 
 type Client interface {
 	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
+	// GenerateEmbeddings embeds texts in as few provider calls as possible.
+	// Embeddings are returned in the order of texts.
+	GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error)
 	GetQueryHash(text string) string
 }
 
+// Batch holds embeddings in input order together with the token usage
+// reported by the provider. Usage only counts texts that were sent to the
+// provider, so cache hits are free.
+type Batch struct {
+	Embeddings   [][]float32
+	PromptTokens int
+	TotalTokens  int
+}
+
+// Provider limits for a single embeddings request. The provider allows
+// 300k tokens; the budget keeps 50k in reserve because estimateTokens is
+// only an approximation.
+const (
+	maxBatchInputs = 2048
+	maxBatchTokens = 250000
+)
+
+// client talks to the OpenAI embeddings API and to services that copy it,
+// such as Azure OpenAI.
 type client struct {
 	httpClient *http.Client
 	endpoint   string
-	apiKey     string
+	header     http.Header
 	model      string
+	maxInputs  int
+	maxTokens  int
 }
 
 func NewClient(endpoint, apiKey, model string, timeout time.Duration) Client {
@@ -30,54 +57,176 @@ func NewClient(endpoint, apiKey, model string, timeout time.Duration) Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		endpoint: endpoint,
-		apiKey:   apiKey,
-		model:    model,
+		endpoint:  endpoint,
+		header:    http.Header{"Authorization": {"Bearer " + apiKey}},
+		model:     model,
+		maxInputs: maxBatchInputs,
+		maxTokens: maxBatchTokens,
+	}
+}
+
+// NewAzureClient calls an Azure OpenAI embeddings deployment. endpoint is
+// the resource URL, e.g. https://my-resource.openai.azure.com.
+func NewAzureClient(endpoint, apiKey, deployment, apiVersion string, timeout time.Duration) Client {
+	return &client{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint: fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s",
+			strings.TrimRight(endpoint, "/"), url.PathEscape(deployment), url.QueryEscape(apiVersion)),
+		header:    http.Header{"Api-Key": {apiKey}},
+		model:     deployment,
+		maxInputs: maxBatchInputs,
+		maxTokens: maxBatchTokens,
 	}
 }
 
 func (c *client) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embedResp, err := c.embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(embedResp.Data) == 0 {
+		return nil, fmt.Errorf("no embedding data in response")
+	}
+
+	return embedResp.Data[0].Embedding, nil
+}
+
+// GenerateEmbeddings splits texts into requests that stay within the
+// provider's input count and token limits and sums their usage.
+func (c *client) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	batch := &Batch{Embeddings: make([][]float32, 0, len(texts))}
+
+	for _, chunk := range c.chunk(texts) {
+		embedResp, err := c.embed(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		embeddings := make([][]float32, len(chunk))
+		for _, data := range embedResp.Data {
+			if data.Index < 0 || data.Index >= len(chunk) {
+				return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+			}
+			embeddings[data.Index] = data.Embedding
+		}
+
+		for i, embedding := range embeddings {
+			if embedding == nil {
+				return nil, fmt.Errorf("no embedding returned for input %d", len(batch.Embeddings)+i)
+			}
+		}
+
+		batch.Embeddings = append(batch.Embeddings, embeddings...)
+		batch.PromptTokens += embedResp.Usage.PromptTokens
+		batch.TotalTokens += embedResp.Usage.TotalTokens
+	}
+
+	return batch, nil
+}
+
+// chunk groups consecutive texts so that no group exceeds maxInputs texts
+// or maxTokens estimated tokens. A single text over the token budget is
+// sent on its own and left for the provider to reject.
+func (c *client) chunk(texts []string) [][]string {
+	var chunks [][]string
+	start, tokens := 0, 0
+
+	for i, text := range texts {
+		textTokens := estimateTokens(text)
+		if i > start && (i-start >= c.maxInputs || tokens+textTokens > c.maxTokens) {
+			chunks = append(chunks, texts[start:i])
+			start, tokens = i, 0
+		}
+		tokens += textTokens
+	}
+
+	if start < len(texts) {
+		chunks = append(chunks, texts[start:])
+	}
+
+	return chunks
+}
+
+// estimateTokens approximates a tokenizer at four bytes per token for ASCII
+// text, which is close for English. Tokenizers split CJK text and emoji
+// into one or more tokens per character, where four bytes per token would
+// count a single token for a whole character or less, so every non-ASCII
+// character is counted as a token of its own.
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return ascii/4 + other + 1
+}
+
+func (c *client) embed(ctx context.Context, input any) (*types.EmbeddingResponse, error) {
 	reqBody := types.EmbeddingRequest{
-		Input: text,
+		Input: input,
 		Model: c.model,
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
+	var embedResp types.EmbeddingResponse
+	if err := postJSON(ctx, c.httpClient, c.endpoint, c.header, reqBody, &embedResp); err != nil {
+		return nil, err
+	}
+
+	return &embedResp, nil
+}
+
+func (c *client) GetQueryHash(text string) string {
+	return hashText(text)
+}
+
+// postJSON sends body to endpoint and decodes the JSON response into out.
+// Non-200 responses become a *StatusError.
+func postJSON(ctx context.Context, httpClient *http.Client, endpoint string, header http.Header, body, out any) error {
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+		return fmt.Errorf("failed to send request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("embedding service returned status %d", resp.StatusCode)
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
-	var embedResp types.EmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if len(embedResp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data in response")
-	}
-
-	return embedResp.Data[0].Embedding, nil
+	return nil
 }
 
-func (c *client) GetQueryHash(text string) string {
+func hashText(text string) string {
 	hash := sha256.Sum256([]byte(text))
 	return hex.EncodeToString(hash[:])
 }
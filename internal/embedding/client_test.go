@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// embeddingServer answers every request with one-element embeddings holding
+// the input's length, listed in reverse order to exercise index mapping.
+func embeddingServer(t *testing.T, requests *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*requests = append(*requests, req.Input)
+
+		var resp types.EmbeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Embedding []float32 `json:"embedding"`
+				Index     int       `json:"index"`
+			}{Embedding: []float32{float32(len(req.Input[i]))}, Index: i})
+		}
+		resp.Usage.PromptTokens = len(req.Input)
+		resp.Usage.TotalTokens = len(req.Input)
+
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+func TestClient_GenerateEmbeddings_ChunksAndMapsByIndex(t *testing.T) {
+	var requests [][]string
+	server := embeddingServer(t, &requests)
+	defer server.Close()
+
+	c := NewClient(server.URL, "key", "model", time.Second).(*client)
+	c.maxInputs = 2
+
+	batch, err := c.GenerateEmbeddings(context.Background(), []string{"a", "bb", "ccc", "dddd", "eeeee"})
+
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc", "dddd"}, {"eeeee"}}, requests)
+	assert.Equal(t, [][]float32{{1}, {2}, {3}, {4}, {5}}, batch.Embeddings)
+	assert.Equal(t, 5, batch.PromptTokens)
+	assert.Equal(t, 5, batch.TotalTokens)
+}
+
+func TestClient_Chunk_TokenBudget(t *testing.T) {
+	c := &client{maxInputs: 100, maxTokens: 10}
+	long := strings.Repeat("x", 40) // 11 estimated tokens
+
+	chunks := c.chunk([]string{"aaaa", "bbbb", "cccc", "dddd", long, "eeee"})
+
+	assert.Equal(t, [][]string{{"aaaa", "bbbb", "cccc", "dddd"}, {long}, {"eeee"}}, chunks)
+	assert.Empty(t, c.chunk(nil))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 3, estimateTokens("Crashes!"))
+	assert.Equal(t, 5, estimateTokens("应用崩溃"))
+	assert.Equal(t, 3, estimateTokens("ok 🔥🔥"))
+}
+
+func TestAzureClient_UsesDeploymentURLAndAPIKeyHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/openai/deployments/embed-small/embeddings", r.URL.Path)
+		assert.Equal(t, "2024-02-01", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "secret", r.Header.Get("api-key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		w.Write([]byte(`{"data": [{"embedding": [0.5, 0.25], "index": 0}], "usage": {"prompt_tokens": 2, "total_tokens": 2}}`))
+	}))
+	defer server.Close()
+
+	c := NewAzureClient(server.URL+"/", "secret", "embed-small", "2024-02-01", time.Second)
+
+	vec, err := c.GenerateEmbedding(context.Background(), "hello")
+
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.5, 0.25}, vec)
+}
@@ -0,0 +1,68 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrRateLimited is matched by errors caused by the provider throttling
+	// requests.
+	ErrRateLimited = errors.New("embedding provider rate limited")
+	// ErrUnavailable is matched by errors caused by the provider failing or
+	// being unreachable.
+	ErrUnavailable = errors.New("embedding provider unavailable")
+	// ErrCircuitOpen is returned without calling the provider while the
+	// circuit breaker is open. It matches ErrUnavailable.
+	ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+)
+
+// StatusError is returned when the provider answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the provider, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embedding service returned status %d", e.StatusCode)
+}
+
+// Is lets callers match on ErrRateLimited and ErrUnavailable.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,172 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStats reports lookups served by an in-memory cache tier.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+type lruEntry struct {
+	hash      string
+	embedding []float32
+	expiresAt time.Time
+}
+
+// LRUClient is a bounded in-memory cache in front of another Client.
+// Concurrent misses for the same text share a single upstream call.
+type LRUClient struct {
+	Client
+	size  int
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewLRUClient(next Client, size int, ttl time.Duration) *LRUClient {
+	return &LRUClient{
+		Client:  next,
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	hash := c.GetQueryHash(text)
+
+	if embedding, ok := c.get(hash); ok {
+		c.hits.Add(1)
+		return embedding, nil
+	}
+	c.misses.Add(1)
+
+	// The shared call must not be cancelled when only the caller that
+	// started it goes away; each caller still stops waiting on its own ctx.
+	upstreamCtx := context.WithoutCancel(ctx)
+	result := c.group.DoChan(hash, func() (any, error) {
+		embedding, err := c.Client.GenerateEmbedding(upstreamCtx, text)
+		if err != nil {
+			return nil, err
+		}
+		c.put(hash, embedding)
+		return embedding, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]float32), nil
+	}
+}
+
+// GenerateEmbeddings serves cached texts from memory and embeds the rest in
+// a single call to the wrapped client.
+func (c *LRUClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	result := &Batch{Embeddings: make([][]float32, len(texts))}
+	var missTexts []string
+	var missIndexes []int
+
+	for i, text := range texts {
+		if embedding, ok := c.get(c.GetQueryHash(text)); ok {
+			c.hits.Add(1)
+			result.Embeddings[i] = embedding
+			continue
+		}
+		c.misses.Add(1)
+		missTexts = append(missTexts, text)
+		missIndexes = append(missIndexes, i)
+	}
+
+	if len(missTexts) > 0 {
+		batch, err := c.Client.GenerateEmbeddings(ctx, missTexts)
+		if err != nil {
+			return nil, err
+		}
+
+		result.PromptTokens = batch.PromptTokens
+		result.TotalTokens = batch.TotalTokens
+
+		for j, i := range missIndexes {
+			result.Embeddings[i] = batch.Embeddings[j]
+			c.put(c.GetQueryHash(missTexts[j]), batch.Embeddings[j])
+		}
+	}
+
+	return result, nil
+}
+
+// Stats returns the hit and miss counters since the client was created.
+func (c *LRUClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+func (c *LRUClient) get(hash string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.embedding, true
+}
+
+func (c *LRUClient) put(hash string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[hash]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.embedding = embedding
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[hash] = c.order.PushFront(&lruEntry{
+		hash:      hash,
+		embedding: embedding,
+		expiresAt: expiresAt,
+	})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).hash)
+	}
+}
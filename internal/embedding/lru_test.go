@@ -0,0 +1,74 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingClient struct {
+	stubClient
+	release chan struct{}
+}
+
+func (c *blockingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	<-c.release
+	return c.stubClient.GenerateEmbedding(ctx, text)
+}
+
+func TestLRUClient_HitsAndEviction(t *testing.T) {
+	inner := &stubClient{vec: []float32{1}}
+	client := NewLRUClient(inner, 2, time.Hour)
+	ctx := context.Background()
+
+	for _, text := range []string{"a", "b", "a", "c", "b"} {
+		_, err := client.GenerateEmbedding(ctx, text)
+		require.NoError(t, err)
+	}
+
+	// "b" was evicted when "c" was added because "a" had been used more recently.
+	assert.Equal(t, 4, inner.callCount())
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 4}, client.Stats())
+}
+
+func TestLRUClient_ExpiresEntries(t *testing.T) {
+	inner := &stubClient{vec: []float32{1}}
+	client := NewLRUClient(inner, 10, time.Millisecond)
+	ctx := context.Background()
+
+	_, err := client.GenerateEmbedding(ctx, "a")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = client.GenerateEmbedding(ctx, "a")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, inner.callCount())
+}
+
+func TestLRUClient_DeduplicatesConcurrentMisses(t *testing.T) {
+	inner := &blockingClient{stubClient: stubClient{vec: []float32{1}}, release: make(chan struct{})}
+	client := NewLRUClient(inner, 10, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vec, err := client.GenerateEmbedding(context.Background(), "same query")
+			assert.NoError(t, err)
+			assert.Equal(t, []float32{1}, vec)
+		}()
+	}
+
+	// Give the goroutines time to join the in-flight call before releasing it.
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, inner.callCount())
+	assert.Equal(t, uint64(10), client.Stats().Misses)
+}
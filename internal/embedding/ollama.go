@@ -0,0 +1,67 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+type ollamaClient struct {
+	httpClient *http.Client
+	endpoint   string
+	model      string
+}
+
+// NewOllamaClient calls a local Ollama server. endpoint is the server URL,
+// e.g. http://localhost:11434.
+func NewOllamaClient(endpoint, model string, timeout time.Duration) Client {
+	return &ollamaClient{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint: strings.TrimRight(endpoint, "/") + "/api/embeddings",
+		model:    model,
+	}
+}
+
+func (c *ollamaClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	reqBody := types.OllamaEmbeddingRequest{
+		Model:  c.model,
+		Prompt: text,
+	}
+
+	var embedResp types.OllamaEmbeddingResponse
+	if err := postJSON(ctx, c.httpClient, c.endpoint, nil, reqBody, &embedResp); err != nil {
+		return nil, err
+	}
+
+	if len(embedResp.Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding data in response")
+	}
+
+	return embedResp.Embedding, nil
+}
+
+// GenerateEmbeddings embeds texts one at a time, since /api/embeddings
+// takes a single prompt. Ollama does not report usage.
+func (c *ollamaClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	batch := &Batch{Embeddings: make([][]float32, len(texts))}
+
+	for i, text := range texts {
+		embedding, err := c.GenerateEmbedding(ctx, text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed input %d: %w", i, err)
+		}
+		batch.Embeddings[i] = embedding
+	}
+
+	return batch, nil
+}
+
+func (c *ollamaClient) GetQueryHash(text string) string {
+	return hashText(text)
+}
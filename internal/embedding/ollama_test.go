@@ -0,0 +1,51 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+func TestOllamaClient_GenerateEmbeddings(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/embeddings", r.URL.Path)
+
+		var req types.OllamaEmbeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+		prompts = append(prompts, req.Prompt)
+
+		json.NewEncoder(w).Encode(types.OllamaEmbeddingResponse{Embedding: []float32{float32(len(req.Prompt))}})
+	}))
+	defer server.Close()
+
+	c := NewOllamaClient(server.URL, "nomic-embed-text", time.Second)
+
+	batch, err := c.GenerateEmbeddings(context.Background(), []string{"a", "bbb"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "bbb"}, prompts)
+	assert.Equal(t, [][]float32{{1}, {3}}, batch.Embeddings)
+}
+
+func TestOllamaClient_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := NewOllamaClient(server.URL, "nomic-embed-text", time.Second)
+
+	_, err := c.GenerateEmbedding(context.Background(), "hello")
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
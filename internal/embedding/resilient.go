@@ -0,0 +1,186 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ResilienceConfig controls retries and the circuit breaker around the
+// embedding provider. Zero values disable the corresponding feature.
+type ResilienceConfig struct {
+	MaxRetries     int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	FailureLimit   int
+	BreakerTimeout time.Duration
+}
+
+type resilientClient struct {
+	Client
+	config  ResilienceConfig
+	breaker *breaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// NewResilientClient retries rate limited and failed provider calls with
+// jittered exponential backoff and stops calling the provider for
+// BreakerTimeout after FailureLimit consecutive failures.
+func NewResilientClient(next Client, config ResilienceConfig) Client {
+	return &resilientClient{
+		Client:  next,
+		config:  config,
+		breaker: &breaker{limit: config.FailureLimit, timeout: config.BreakerTimeout},
+		sleep:   sleepContext,
+	}
+}
+
+func (c *resilientClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return call(ctx, c, func() ([]float32, error) {
+		return c.Client.GenerateEmbedding(ctx, text)
+	})
+}
+
+func (c *resilientClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	return call(ctx, c, func() (*Batch, error) {
+		return c.Client.GenerateEmbeddings(ctx, texts)
+	})
+}
+
+func call[T any](ctx context.Context, c *resilientClient, fn func() (T, error)) (T, error) {
+	var zero T
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return zero, ErrCircuitOpen
+		}
+
+		result, err := fn()
+		switch {
+		case err == nil:
+			c.breaker.record(true)
+			return result, nil
+		case countsAsFailure(ctx, err):
+			c.breaker.record(false)
+		default:
+			c.breaker.release()
+		}
+
+		if attempt >= c.config.MaxRetries || !retryable(err) {
+			return zero, err
+		}
+
+		delay := c.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if c.config.MaxDelay > 0 && statusErr.RetryAfter > c.config.MaxDelay {
+				return zero, err
+			}
+			delay = statusErr.RetryAfter
+		}
+
+		if err := c.sleep(ctx, delay); err != nil {
+			return zero, err
+		}
+	}
+}
+
+// backoff returns a delay between half and all of BaseDelay*2^attempt,
+// capped at MaxDelay.
+func (c *resilientClient) backoff(attempt int) time.Duration {
+	delay := c.config.BaseDelay << attempt
+	if c.config.MaxDelay > 0 && (delay > c.config.MaxDelay || delay <= 0) {
+		delay = c.config.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func retryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+}
+
+// countsAsFailure reports whether err says something about the provider's
+// health. Client errors and cancelled requests do not.
+func countsAsFailure(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && errors.Is(err, ErrUnavailable)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// breaker opens after limit consecutive failures and lets a single trial
+// call through once timeout has passed.
+type breaker struct {
+	limit   int
+	timeout time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *breaker) allow() bool {
+	if b.limit <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.limit {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.timeout {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// release ends a trial call whose outcome says nothing about the provider,
+// leaving the failure count as it was so the next call can be the trial.
+func (b *breaker) release() {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) record(success bool) {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.limit {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,135 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedClient returns the queued errors in order, then succeeds.
+type scriptedClient struct {
+	stubClient
+	errs []error
+}
+
+func (c *scriptedClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	return c.vec, nil
+}
+
+func newTestResilientClient(next Client, config ResilienceConfig) (*resilientClient, *[]time.Duration) {
+	var delays []time.Duration
+	c := NewResilientClient(next, config).(*resilientClient)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return c, &delays
+}
+
+func TestResilientClient_RetriesWithBackoffAndRetryAfter(t *testing.T) {
+	inner := &scriptedClient{
+		stubClient: stubClient{vec: []float32{1}},
+		errs: []error{
+			&StatusError{StatusCode: http.StatusServiceUnavailable},
+			&StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second},
+		},
+	}
+	c, delays := newTestResilientClient(inner, ResilienceConfig{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second})
+
+	vec, err := c.GenerateEmbedding(context.Background(), "hello")
+
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1}, vec)
+	assert.Equal(t, 3, inner.callCount())
+	require.Len(t, *delays, 2)
+	assert.GreaterOrEqual(t, (*delays)[0], 50*time.Millisecond)
+	assert.LessOrEqual(t, (*delays)[0], 100*time.Millisecond)
+	assert.Equal(t, 3*time.Second, (*delays)[1])
+}
+
+func TestResilientClient_DoesNotRetryClientErrors(t *testing.T) {
+	inner := &scriptedClient{errs: []error{&StatusError{StatusCode: http.StatusBadRequest}}}
+	c, _ := newTestResilientClient(inner, ResilienceConfig{MaxRetries: 3, BaseDelay: time.Millisecond})
+
+	_, err := c.GenerateEmbedding(context.Background(), "hello")
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.False(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 1, inner.callCount())
+}
+
+func TestResilientClient_CircuitBreaker(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusBadGateway}
+	inner := &scriptedClient{
+		stubClient: stubClient{vec: []float32{1}},
+		errs:       []error{unavailable, unavailable},
+	}
+	c, _ := newTestResilientClient(inner, ResilienceConfig{FailureLimit: 2, BreakerTimeout: time.Hour})
+
+	for range 2 {
+		_, err := c.GenerateEmbedding(context.Background(), "hello")
+		assert.ErrorIs(t, err, ErrUnavailable)
+	}
+
+	_, err := c.GenerateEmbedding(context.Background(), "hello")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 2, inner.callCount())
+
+	c.breaker.openedAt = time.Now().Add(-2 * time.Hour)
+
+	vec, err := c.GenerateEmbedding(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1}, vec)
+	assert.Equal(t, 0, c.breaker.failures)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, parseRetryAfter("2"))
+	assert.Zero(t, parseRetryAfter(""))
+	assert.Zero(t, parseRetryAfter("soon"))
+
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, time.Minute, parseRetryAfter(at), float64(2*time.Second))
+}
+
+func TestResilientClient_BreakerIgnoresNeutralOutcomes(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusBadGateway}
+	inner := &scriptedClient{
+		stubClient: stubClient{vec: []float32{1}},
+		errs:       []error{unavailable, &StatusError{StatusCode: http.StatusBadRequest}, unavailable},
+	}
+	c, _ := newTestResilientClient(inner, ResilienceConfig{FailureLimit: 2, BreakerTimeout: time.Hour})
+
+	for range 3 {
+		_, _ = c.GenerateEmbedding(context.Background(), "hello")
+	}
+
+	_, err := c.GenerateEmbedding(context.Background(), "hello")
+	assert.ErrorIs(t, err, ErrCircuitOpen, "a 4xx must not reset the failure count")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.breaker.openedAt = time.Now().Add(-2 * time.Hour)
+	inner.errs = []error{ctx.Err()}
+
+	_, err = c.GenerateEmbedding(ctx, "hello")
+	require.Error(t, err)
+	assert.Equal(t, 2, c.breaker.failures, "a cancelled trial must not close the breaker")
+	assert.False(t, c.breaker.trial)
+}
@@ -0,0 +1,89 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// teiMaxInputs matches the default --max-client-batch-size of
+// text-embeddings-inference.
+const teiMaxInputs = 32
+
+type teiClient struct {
+	httpClient *http.Client
+	endpoint   string
+	header     http.Header
+	maxInputs  int
+}
+
+// NewTEIClient calls a HuggingFace text-embeddings-inference server. The
+// server hosts a single model, so none is sent. apiKey may be empty.
+func NewTEIClient(endpoint, apiKey string, timeout time.Duration) Client {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	return &teiClient{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint:  strings.TrimRight(endpoint, "/") + "/embed",
+		header:    header,
+		maxInputs: teiMaxInputs,
+	}
+}
+
+func (c *teiClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := c.embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddings sends texts in groups of at most maxInputs. TEI does
+// not report usage.
+func (c *teiClient) GenerateEmbeddings(ctx context.Context, texts []string) (*Batch, error) {
+	batch := &Batch{Embeddings: make([][]float32, 0, len(texts))}
+
+	for start := 0; start < len(texts); start += c.maxInputs {
+		end := min(start+c.maxInputs, len(texts))
+
+		embeddings, err := c.embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		batch.Embeddings = append(batch.Embeddings, embeddings...)
+	}
+
+	return batch, nil
+}
+
+func (c *teiClient) embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	reqBody := types.TEIEmbedRequest{
+		Inputs:   inputs,
+		Truncate: true,
+	}
+
+	var embeddings [][]float32
+	if err := postJSON(ctx, c.httpClient, c.endpoint, c.header, reqBody, &embeddings); err != nil {
+		return nil, err
+	}
+
+	if len(embeddings) != len(inputs) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(embeddings))
+	}
+
+	return embeddings, nil
+}
+
+func (c *teiClient) GetQueryHash(text string) string {
+	return hashText(text)
+}
@@ -0,0 +1,57 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+func TestTEIClient_GenerateEmbeddings(t *testing.T) {
+	var requests [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/embed", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var req types.TEIEmbedRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Truncate)
+		requests = append(requests, req.Inputs)
+
+		embeddings := make([][]float32, len(req.Inputs))
+		for i, input := range req.Inputs {
+			embeddings[i] = []float32{float32(len(input))}
+		}
+		json.NewEncoder(w).Encode(embeddings)
+	}))
+	defer server.Close()
+
+	c := NewTEIClient(server.URL, "token", time.Second).(*teiClient)
+	c.maxInputs = 2
+
+	batch, err := c.GenerateEmbeddings(context.Background(), []string{"a", "bb", "ccc"})
+
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, requests)
+	assert.Equal(t, [][]float32{{1}, {2}, {3}}, batch.Embeddings)
+}
+
+func TestTEIClient_RejectsShortResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	c := NewTEIClient(server.URL, "", time.Second)
+
+	_, err := c.GenerateEmbedding(context.Background(), "hello")
+
+	assert.ErrorContains(t, err, "expected 1 embeddings, got 0")
+}
@@ -0,0 +1,175 @@
+package generation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+var (
+	citationMarker = regexp.MustCompile(`\s*\[([^\[\]\n]+)\]`)
+	citationID     = regexp.MustCompile(`^[A-Za-z0-9_.:\-]+$`)
+)
+
+type marker struct {
+	offset int
+	ids    []string
+}
+
+// ExtractCitations strips "[id]" and "[id1, id2]" markers from a generated
+// answer and returns the clean answer with one citation per cited sentence.
+// Offsets are in characters of the clean answer. Only brackets naming at
+// least one of the reviews are markers, so text such as "[sic]" or "[v2.1]"
+// stays in the answer; other IDs inside a marker are kept for the caller to
+// report.
+func ExtractCitations(answer string, reviews []types.RetrievedReview) (string, []types.Citation) {
+	retrieved := make(map[string]struct{}, len(reviews))
+	for _, review := range reviews {
+		retrieved[review.ID] = struct{}{}
+	}
+
+	var clean strings.Builder
+	var markers []marker
+	cleanLen := 0
+	last := 0
+
+	for _, loc := range citationMarker.FindAllStringSubmatchIndex(answer, -1) {
+		ids := parseCitationIDs(answer[loc[2]:loc[3]])
+		if !citesAny(ids, retrieved) {
+			continue
+		}
+
+		segment := answer[last:loc[0]]
+		clean.WriteString(segment)
+		cleanLen += len([]rune(segment))
+		markers = append(markers, marker{offset: cleanLen, ids: ids})
+		last = loc[1]
+	}
+	clean.WriteString(answer[last:])
+
+	trimmed := strings.TrimLeftFunc(clean.String(), unicode.IsSpace)
+	leading := cleanLen + len([]rune(answer[last:])) - len([]rune(trimmed))
+	text := []rune(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	sentences := splitSentences(text)
+
+	var citations []types.Citation
+	bySentence := make(map[int]int)
+
+	for _, m := range markers {
+		pos := m.offset - leading - 1
+		if pos < 0 {
+			pos = 0
+		}
+
+		idx := sentenceAt(sentences, pos)
+		if idx < 0 {
+			continue
+		}
+
+		ci, ok := bySentence[idx]
+		if !ok {
+			span := sentences[idx]
+			citations = append(citations, types.Citation{
+				Start: span[0],
+				End:   span[1],
+				Text:  string(text[span[0]:span[1]]),
+			})
+			ci = len(citations) - 1
+			bySentence[idx] = ci
+		}
+
+		for _, id := range m.ids {
+			if !containsString(citations[ci].ReviewIDs, id) {
+				citations[ci].ReviewIDs = append(citations[ci].ReviewIDs, id)
+			}
+		}
+	}
+
+	return string(text), citations
+}
+
+func parseCitationIDs(raw string) []string {
+	parts := strings.Split(raw, ",")
+	ids := make([]string, 0, len(parts))
+	for _, part := range parts {
+		id := strings.TrimSpace(part)
+		if !citationID.MatchString(id) {
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func citesAny(ids []string, retrieved map[string]struct{}) bool {
+	for _, id := range ids {
+		if _, ok := retrieved[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSentences returns [start, end) rune spans of the sentences in text,
+// with surrounding whitespace excluded.
+func splitSentences(text []rune) [][2]int {
+	var spans [][2]int
+	start := -1
+
+	for i, r := range text {
+		if start < 0 {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			start = i
+		}
+
+		end := false
+		switch r {
+		case '\n':
+			end = true
+		case '.', '!', '?':
+			end = i+1 == len(text) || unicode.IsSpace(text[i+1])
+		}
+
+		if end {
+			stop := i + 1
+			if r == '\n' {
+				stop = i
+			}
+			for stop > start && unicode.IsSpace(text[stop-1]) {
+				stop--
+			}
+			if stop > start {
+				spans = append(spans, [2]int{start, stop})
+			}
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+func sentenceAt(spans [][2]int, pos int) int {
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i][0] <= pos {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
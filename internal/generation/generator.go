@@ -0,0 +1,63 @@
+package generation
+
+import (
+	"context"
+	"log"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// Generator turns a user question and the reviews retrieved for it into an answer.
+type Generator interface {
+	Generate(ctx context.Context, query string, reviews []types.RetrievedReview) (string, error)
+	// GenerateStream behaves like Generate but passes the answer to onToken
+	// incrementally. It stops as soon as onToken returns an error.
+	GenerateStream(ctx context.Context, query string, reviews []types.RetrievedReview, onToken func(string) error) (string, error)
+}
+
+type fallbackGenerator struct {
+	primary  Generator
+	fallback Generator
+}
+
+// NewFallbackGenerator returns a Generator that uses primary and switches to
+// fallback whenever primary fails, so a provider outage never fails a query.
+func NewFallbackGenerator(primary, fallback Generator) Generator {
+	return &fallbackGenerator{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+func (g *fallbackGenerator) Generate(ctx context.Context, query string, reviews []types.RetrievedReview) (string, error) {
+	answer, err := g.primary.Generate(ctx, query, reviews)
+	if err == nil {
+		return answer, nil
+	}
+
+	if ctx.Err() != nil {
+		return "", err
+	}
+
+	log.Printf("Answer generation failed, using fallback: %v", err)
+	return g.fallback.Generate(ctx, query, reviews)
+}
+
+func (g *fallbackGenerator) GenerateStream(ctx context.Context, query string, reviews []types.RetrievedReview, onToken func(string) error) (string, error) {
+	emitted := false
+	answer, err := g.primary.GenerateStream(ctx, query, reviews, func(token string) error {
+		emitted = true
+		return onToken(token)
+	})
+	if err == nil {
+		return answer, nil
+	}
+
+	// Once tokens reached the client we cannot take them back.
+	if emitted || ctx.Err() != nil {
+		return "", err
+	}
+
+	log.Printf("Answer generation failed, using fallback: %v", err)
+	return g.fallback.GenerateStream(ctx, query, reviews, onToken)
+}
@@ -0,0 +1,161 @@
+package generation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReviews() []types.RetrievedReview {
+	return []types.RetrievedReview{
+		{ID: "review-1", Title: "Crashes", Content: "The app crashes on launch.", Rating: 1, Country: "US"},
+		{ID: "review-2", Content: "Love the new dark mode.", Rating: 5, Country: "DE"},
+	}
+}
+
+func TestOpenAIGenerator_Generate(t *testing.T) {
+	var received types.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":" Users report launch crashes. "}}]}`))
+	}))
+	defer server.Close()
+
+	generator := NewOpenAIGenerator(server.URL, "test-key", "gpt-test", 256, 0.1, 5*time.Second)
+
+	answer, err := generator.Generate(context.Background(), "What are the main complaints?", testReviews())
+
+	require.NoError(t, err)
+	assert.Equal(t, "Users report launch crashes.", answer)
+	assert.Equal(t, "gpt-test", received.Model)
+	assert.Equal(t, 256, received.MaxTokens)
+	require.Len(t, received.Messages, 2)
+	assert.Equal(t, "system", received.Messages[0].Role)
+	assert.Contains(t, received.Messages[1].Content, "id: review-1")
+	assert.Contains(t, received.Messages[1].Content, "The app crashes on launch.")
+	assert.Contains(t, received.Messages[1].Content, "Question: What are the main complaints?")
+}
+
+func TestOpenAIGenerator_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	generator := NewOpenAIGenerator(server.URL, "", "gpt-test", 0, 0, 5*time.Second)
+
+	_, err := generator.Generate(context.Background(), "query", testReviews())
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status 500")
+}
+
+func TestFallbackGenerator_UsesTemplateOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	generator := NewFallbackGenerator(
+		NewOpenAIGenerator(server.URL, "", "gpt-test", 0, 0, 5*time.Second),
+		NewTemplateGenerator(),
+	)
+
+	answer, err := generator.Generate(context.Background(), "query", testReviews())
+
+	require.NoError(t, err)
+	assert.Contains(t, answer, "Based on 2 relevant reviews")
+	assert.Contains(t, answer, "the sentiment is mixed")
+}
+
+func TestBuildMessages_TruncatesOnCharacters(t *testing.T) {
+	content := strings.Repeat("é", maxReviewChars+10)
+	messages := BuildMessages("query", []types.RetrievedReview{{ID: "review-1", Content: content}})
+
+	prompt := messages[len(messages)-1].Content
+	assert.True(t, utf8.ValidString(prompt))
+	assert.Contains(t, prompt, strings.Repeat("é", maxReviewChars)+"...")
+	assert.NotContains(t, prompt, strings.Repeat("é", maxReviewChars+1))
+}
+
+func TestExtractCitations(t *testing.T) {
+	reviews := append(testReviews(), types.RetrievedReview{ID: "review-3"})
+	answer, citations := ExtractCitations("Many users report crashes on launch [review-1]. Dark mode is popular. [review-2, review-3]\nSome mention [see below] odd things [sic] since [v2.1].", reviews)
+
+	assert.Equal(t, "Many users report crashes on launch. Dark mode is popular.\nSome mention [see below] odd things [sic] since [v2.1].", answer)
+	require.Len(t, citations, 2)
+
+	assert.Equal(t, "Many users report crashes on launch.", citations[0].Text)
+	assert.Equal(t, []string{"review-1"}, citations[0].ReviewIDs)
+	assert.Equal(t, citations[0].Text, string([]rune(answer)[citations[0].Start:citations[0].End]))
+
+	assert.Equal(t, "Dark mode is popular.", citations[1].Text)
+	assert.Equal(t, []string{"review-2", "review-3"}, citations[1].ReviewIDs)
+	assert.Equal(t, citations[1].Text, string([]rune(answer)[citations[1].Start:citations[1].End]))
+}
+
+func TestExtractCitations_NoMarkers(t *testing.T) {
+	answer, citations := ExtractCitations("  Nothing to cite here.  ", testReviews())
+
+	assert.Equal(t, "Nothing to cite here.", answer)
+	assert.Empty(t, citations)
+}
+
+func TestOpenAIGenerator_GenerateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n"))
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Users \"}}]}\n\n"))
+		w.Write([]byte(": keep-alive\n\n"))
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"love it.\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	generator := NewOpenAIGenerator(server.URL, "", "gpt-test", 0, 0, 5*time.Second)
+
+	var tokens []string
+	answer, err := generator.GenerateStream(context.Background(), "query", testReviews(), func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Users love it.", answer)
+	assert.Equal(t, []string{"Users ", "love it."}, tokens)
+}
+
+func TestOpenAIGenerator_GenerateStreamOutlivesTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Users \"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"love it.\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	generator := NewOpenAIGenerator(server.URL, "", "gpt-test", 0, 0, 50*time.Millisecond)
+
+	answer, err := generator.GenerateStream(context.Background(), "query", testReviews(), func(string) error { return nil })
+
+	require.NoError(t, err)
+	assert.Equal(t, "Users love it.", answer)
+}
@@ -0,0 +1,162 @@
+package generation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+type openAIGenerator struct {
+	httpClient  *http.Client
+	timeout     time.Duration
+	endpoint    string
+	apiKey      string
+	model       string
+	maxTokens   int
+	temperature float64
+}
+
+// NewOpenAIGenerator returns a Generator backed by an OpenAI-compatible
+// chat completions endpoint. timeout bounds a whole Generate call, but only
+// the wait for response headers of a GenerateStream call: a stream runs for
+// as long as its context allows.
+func NewOpenAIGenerator(endpoint, apiKey, model string, maxTokens int, temperature float64, timeout time.Duration) Generator {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	return &openAIGenerator{
+		httpClient: &http.Client{
+			Transport: transport,
+		},
+		timeout:     timeout,
+		endpoint:    endpoint,
+		apiKey:      apiKey,
+		model:       model,
+		maxTokens:   maxTokens,
+		temperature: temperature,
+	}
+}
+
+func (g *openAIGenerator) Generate(ctx context.Context, query string, reviews []types.RetrievedReview) (string, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	resp, err := g.send(ctx, query, reviews, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var chatResp types.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	answer := strings.TrimSpace(chatResp.Choices[0].Message.Content)
+	if answer == "" {
+		return "", fmt.Errorf("empty answer in response")
+	}
+
+	return answer, nil
+}
+
+func (g *openAIGenerator) GenerateStream(ctx context.Context, query string, reviews []types.RetrievedReview, onToken func(string) error) (string, error) {
+	resp, err := g.send(ctx, query, reviews, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk types.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		answer.WriteString(token)
+		if err := onToken(token); err != nil {
+			return "", err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	result := strings.TrimSpace(answer.String())
+	if result == "" {
+		return "", fmt.Errorf("empty answer in response")
+	}
+
+	return result, nil
+}
+
+func (g *openAIGenerator) send(ctx context.Context, query string, reviews []types.RetrievedReview, stream bool) (*http.Response, error) {
+	reqBody := types.ChatCompletionRequest{
+		Model:       g.model,
+		Messages:    BuildMessages(query, reviews),
+		MaxTokens:   g.maxTokens,
+		Temperature: g.temperature,
+		Stream:      stream,
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("generation service returned status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
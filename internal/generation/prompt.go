@@ -0,0 +1,49 @@
+package generation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const maxReviewChars = 1200
+
+const systemPrompt = `You are an analyst answering product questions using app store reviews.
+Answer only from the reviews provided. If the reviews do not contain the answer, say so.
+Be concise, mention recurring themes and how common they are, and do not invent details.
+After each sentence, cite the reviews that support it by their id in square brackets, e.g. [id] or [id1, id2].
+Only cite ids that appear in the reviews below.`
+
+// BuildMessages builds a chat prompt that grounds the answer in the retrieved reviews.
+func BuildMessages(query string, reviews []types.RetrievedReview) []types.ChatMessage {
+	var reviewsText strings.Builder
+	for i, review := range reviews {
+		content := truncate(review.Content, maxReviewChars)
+
+		reviewsText.WriteString(fmt.Sprintf("Review %d (id: %s, app: %s, rating: %d/5, country: %s, date: %s)\n",
+			i+1, review.ID, review.AppID, review.Rating, review.Country, review.Date.Format("2006-01-02")))
+		if review.Title != "" {
+			reviewsText.WriteString("Title: " + review.Title + "\n")
+		}
+		reviewsText.WriteString(content + "\n\n")
+	}
+
+	user := fmt.Sprintf("Reviews:\n\n%sQuestion: %s", reviewsText.String(), query)
+
+	return []types.ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: user},
+	}
+}
+
+// truncate cuts text to at most limit characters, never inside a multi-byte
+// character, and marks the cut with "...".
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit]) + "..."
+}
@@ -0,0 +1,78 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const templateCitations = 3
+
+type templateGenerator struct{}
+
+// NewTemplateGenerator returns a Generator that summarizes review ratings
+// without calling a language model.
+func NewTemplateGenerator() Generator {
+	return &templateGenerator{}
+}
+
+func (g *templateGenerator) Generate(ctx context.Context, query string, reviews []types.RetrievedReview) (string, error) {
+	if len(reviews) == 0 {
+		return "No relevant reviews found to answer your query.", nil
+	}
+
+	var positiveCount, negativeCount int
+	var avgRating float64
+
+	for _, review := range reviews {
+		if review.Rating >= 4 {
+			positiveCount++
+		} else if review.Rating <= 2 {
+			negativeCount++
+		}
+		avgRating += float64(review.Rating)
+	}
+
+	avgRating = avgRating / float64(len(reviews))
+
+	var answer strings.Builder
+	answer.WriteString(fmt.Sprintf("Based on %d relevant reviews, ", len(reviews)))
+
+	if positiveCount > negativeCount {
+		answer.WriteString("the overall sentiment is positive. ")
+	} else if negativeCount > positiveCount {
+		answer.WriteString("the overall sentiment is negative. ")
+	} else {
+		answer.WriteString("the sentiment is mixed. ")
+	}
+
+	answer.WriteString(fmt.Sprintf("The average rating is %.1f/5. ", avgRating))
+
+	answer.WriteString("Here are the most relevant reviews that address your query.")
+
+	ids := make([]string, 0, templateCitations)
+	for i := 0; i < len(reviews) && i < templateCitations; i++ {
+		ids = append(ids, reviews[i].ID)
+	}
+	answer.WriteString(" [" + strings.Join(ids, ", ") + "]")
+
+	return answer.String(), nil
+}
+
+func (g *templateGenerator) GenerateStream(ctx context.Context, query string, reviews []types.RetrievedReview, onToken func(string) error) (string, error) {
+	answer, err := g.Generate(ctx, query, reviews)
+	if err != nil {
+		return "", err
+	}
+
+	words := strings.SplitAfter(answer, " ")
+	for _, word := range words {
+		if err := onToken(word); err != nil {
+			return "", err
+		}
+	}
+
+	return answer, nil
+}
@@ -3,27 +3,48 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/health"
 	"github.com/quiby-ai/review-rag/internal/service"
+	"github.com/quiby-ai/review-rag/internal/storage"
 	"github.com/quiby-ai/review-rag/internal/types"
 )
 
 type RAGHandler struct {
 	ragService *service.RAGService
+	health     *health.Checker
 	validate   *validator.Validate
 }
 
-func NewRAGHandler(ragService *service.RAGService) *RAGHandler {
+func NewRAGHandler(ragService *service.RAGService, healthChecker *health.Checker) *RAGHandler {
 	return &RAGHandler{
 		ragService: ragService,
+		health:     healthChecker,
 		validate:   validator.New(),
 	}
 }
 
+// validateQuery checks query and returns the status to reject it with. A
+// query that passes validation but names no app, such as one with an empty
+// appIds list, is well-formed yet cannot be answered, hence 422.
+func (h *RAGHandler) validateQuery(query types.RAGQuery) (int, error) {
+	if err := h.validate.Struct(query); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Validation error: %v", err)
+	}
+	if len(query.Apps()) == 0 {
+		return http.StatusUnprocessableEntity, errors.New("Validation error: the query names no app; set appId or a non-empty appIds")
+	}
+	return 0, nil
+}
+
 func (h *RAGHandler) HandleRAGQuery(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -36,6 +57,233 @@ func (h *RAGHandler) HandleRAGQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status, err := h.validateQuery(query); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	response, err := h.ragService.Query(ctx, query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("RAG query failed: %v", err), queryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+const batchTimeout = 5 * time.Minute
+
+// HandleRAGQueryBatch answers a list of queries. Items that fail validation
+// or processing get an error in their result; the rest are still answered.
+func (h *RAGHandler) HandleRAGQueryBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.RAGBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	startTime := time.Now()
+
+	results := make([]types.RAGBatchItem, len(request.Queries))
+	var valid []types.RAGQuery
+	var validIndexes []int
+
+	for i, query := range request.Queries {
+		results[i].Index = i
+		if _, err := h.validateQuery(query); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		valid = append(valid, query)
+		validIndexes = append(validIndexes, i)
+	}
+
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchTimeout)); err != nil {
+		log.Printf("Failed to extend write deadline: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+	defer cancel()
+
+	if len(valid) > 0 {
+		items, err := h.ragService.QueryBatch(ctx, valid, request.RetrievalOnly)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("RAG batch query failed: %v", err), queryErrorStatus(err))
+			return
+		}
+
+		for j, item := range items {
+			item.Index = validIndexes[j]
+			results[validIndexes[j]] = item
+		}
+	}
+
+	response := types.RAGBatchResponse{
+		Results:        results,
+		ProcessingTime: time.Since(startTime).Seconds(),
+	}
+	for _, item := range results {
+		if item.Error != "" {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleTrend returns a time series of how many reviews match a query topic.
+func (h *RAGHandler) HandleTrend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.TrendRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	response, err := h.ragService.Trend(ctx, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Trend query failed: %v", err), queryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleRegression compares how common a topic is in the reviews of two app
+// versions.
+func (h *RAGHandler) HandleRegression(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.RegressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	response, err := h.ragService.Regression(ctx, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Regression query failed: %v", err), queryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleCompare answers one query for several apps side by side.
+func (h *RAGHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.CompareRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(request); err != nil {
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	response, err := h.ragService.Compare(ctx, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Comparison failed: %v", err), queryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleThemes clusters an app's reviews into themes. Optional query
+// parameters: k (number of themes) and lastDays.
+func (h *RAGHandler) HandleThemes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := types.ThemesQuery{AppID: r.PathValue("appId")}
+	for name, target := range map[string]*int{"k": &query.K, "lastDays": &query.LastDays} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s: %q", name, value), http.StatusBadRequest)
+			return
+		}
+		*target = n
+	}
+
 	if err := h.validate.Struct(query); err != nil {
 		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
 		return
@@ -44,9 +292,9 @@ func (h *RAGHandler) HandleRAGQuery(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	response, err := h.ragService.Query(ctx, query)
+	response, err := h.ragService.Themes(ctx, query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("RAG query failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Theme clustering failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -58,11 +306,177 @@ func (h *RAGHandler) HandleRAGQuery(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+const streamTimeout = 2 * time.Minute
+
+// HandleRAGQueryStream answers a query as Server-Sent Events: a "reviews"
+// event once retrieval finishes, "token" events while the answer is
+// generated, then a "done" event, or an "error" event on failure.
+func (h *RAGHandler) HandleRAGQueryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var query types.RAGQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if status, err := h.validateQuery(query); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The server write timeout is sized for regular queries; a stream may
+	// legitimately stay open longer.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(streamTimeout)); err != nil {
+		log.Printf("Failed to extend write deadline: %v", err)
+	}
+
+	// r.Context() is cancelled when the client disconnects, which aborts the
+	// embedding request and the database query.
+	ctx, cancel := context.WithTimeout(r.Context(), streamTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(event string, data any) error {
+		if err := writeEvent(w, event, data); err != nil {
+			cancel()
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	response, err := h.ragService.QueryStream(ctx, query, service.StreamObserver{
+		OnReviews: func(reviews []types.RetrievedReview) error {
+			return send("reviews", map[string]any{"retrievedReviews": reviews})
+		},
+		OnToken: func(token string) error {
+			return send("token", map[string]string{"text": token})
+		},
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			send("error", map[string]any{
+				"error":  fmt.Sprintf("RAG query failed: %v", err),
+				"status": queryErrorStatus(err),
+			})
+		}
+		return
+	}
+
+	send("done", types.RAGStreamDone{
+		Answer:              response.Answer,
+		Citations:           response.Citations,
+		UnverifiedCitations: response.UnverifiedCitations,
+		Confidence:          response.Confidence,
+		ProcessingTime:      response.ProcessingTime,
+		QueryHash:           response.QueryHash,
+	})
+}
+
+// queryErrorStatus maps a failed query to the status a client should act on:
+// 429 and 503 tell it to back off and retry, 500 means something broke.
+func queryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, embedding.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, embedding.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrNoVersionColumn):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event, err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// HandleHealthCheck is the liveness probe: it only reports that the process
+// is serving requests.
 func (h *RAGHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandleReadinessCheck reports database and embedding provider status. It
+// answers 503 only when the service cannot serve queries at all; a degraded
+// service stays in rotation.
+func (h *RAGHandler) HandleReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	response := h.health.Check(ctx)
+
+	status := http.StatusOK
+	if response.Status == health.StatusUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode health response: %v", err)
+	}
+}
+
+// HandleEmbeddingMigration reports how far the shadow embeddings of a new
+// model have been backfilled, per app, and whether retrieval uses them yet.
+func (h *RAGHandler) HandleEmbeddingMigration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	status, err := h.ragService.EmbeddingMigrationStatus(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get migration status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		http.Error(w, "No embedding migration configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Failed to encode migration status: %v", err)
+	}
 }
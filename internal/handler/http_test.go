@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleRAGQuery_RejectsQueryWithoutApps(t *testing.T) {
+	h := NewRAGHandler(nil, nil)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty app list", `{"query": "crashes", "appIds": []}`, http.StatusUnprocessableEntity},
+		{"no app at all", `{"query": "crashes"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.HandleRAGQuery(rec, httptest.NewRequest(http.MethodPost, "/rag/query", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
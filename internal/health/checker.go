@@ -0,0 +1,184 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/metrics"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+const (
+	probeText    = "health check"
+	probeTimeout = 5 * time.Second
+)
+
+// Queries cannot be answered without these tables.
+var coreTables = []string{"review_embeddings", "clean_reviews"}
+
+// These only back caching, logging and metrics.
+var auxiliaryTables = []string{"embedding_cache", "rag_query_logs", "rag_metrics", "embedding_models"}
+
+// SchemaChecker is the part of storage.Repository the readiness check uses.
+type SchemaChecker interface {
+	HealthCheck(ctx context.Context) error
+	MissingSchemaObjects(ctx context.Context, tables []string) ([]string, error)
+}
+
+// Checker reports service readiness. Embedding probes cost tokens, so their
+// result is reused for probeTTL.
+type Checker struct {
+	db          SchemaChecker
+	embedClient embedding.Client
+	metrics     *metrics.Collector
+	version     string
+	probeTTL    time.Duration
+
+	mu            sync.Mutex
+	probedAt      time.Time
+	lastProbe     types.EmbeddingHealth
+	modelMismatch *ModelMismatchError
+	// modelCheckErr is why the embedding model could not be verified yet.
+	modelCheckErr error
+}
+
+// NewChecker builds a Checker. embedClient should talk to the provider
+// directly rather than through the caching layers, or the probe proves nothing.
+func NewChecker(db SchemaChecker, embedClient embedding.Client, collector *metrics.Collector, version string, probeTTL time.Duration) *Checker {
+	return &Checker{
+		db:          db,
+		embedClient: embedClient,
+		metrics:     collector,
+		version:     version,
+		probeTTL:    probeTTL,
+	}
+}
+
+// SetModelMismatch makes every check report the embedding model mismatch
+// found at startup. Fatal mismatches make the service unhealthy.
+func (c *Checker) SetModelMismatch(mismatch *ModelMismatchError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modelMismatch = mismatch
+}
+
+// SetModelCheckError makes every check report the service degraded because
+// the embedding model could not be verified, with err as the reason. A nil
+// err clears it.
+func (c *Checker) SetModelCheckError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modelCheckErr = err
+}
+
+// Check returns the overall status together with its components. The
+// service is unhealthy when it cannot read reviews and degraded when it can
+// but some dependency is impaired.
+func (c *Checker) Check(ctx context.Context) types.HealthResponse {
+	database := c.checkDatabase(ctx)
+	embed := c.checkEmbedding(ctx)
+
+	c.mu.Lock()
+	mismatch := c.modelMismatch
+	checkErr := c.modelCheckErr
+	c.mu.Unlock()
+
+	switch {
+	case mismatch != nil:
+		embed = types.EmbeddingHealth{Status: StatusDegraded, Message: mismatch.Error()}
+		if mismatch.Fatal {
+			embed.Status = StatusUnhealthy
+		}
+	case checkErr != nil:
+		embed = types.EmbeddingHealth{Status: StatusDegraded, Message: fmt.Sprintf("embedding model not verified: %v", checkErr)}
+	}
+
+	status := StatusHealthy
+	switch {
+	case database.Status == StatusUnhealthy, mismatch != nil && mismatch.Fatal:
+		status = StatusUnhealthy
+	case database.Status == StatusDegraded, embed.Status != StatusHealthy:
+		status = StatusDegraded
+	}
+
+	return types.HealthResponse{
+		Status:    status,
+		Timestamp: time.Now().UTC(),
+		Version:   c.version,
+		Database:  database,
+		Embedding: embed,
+		Metrics:   c.metrics.Summary(),
+	}
+}
+
+func (c *Checker) checkDatabase(ctx context.Context) types.DatabaseHealth {
+	if err := c.db.HealthCheck(ctx); err != nil {
+		return types.DatabaseHealth{Status: StatusUnhealthy, Message: fmt.Sprintf("ping failed: %v", err)}
+	}
+
+	tables := append(append([]string{}, coreTables...), auxiliaryTables...)
+	missing, err := c.db.MissingSchemaObjects(ctx, tables)
+	if err != nil {
+		return types.DatabaseHealth{Status: StatusUnhealthy, Message: fmt.Sprintf("schema check failed: %v", err)}
+	}
+
+	if len(missing) == 0 {
+		return types.DatabaseHealth{Status: StatusHealthy, Message: "connected"}
+	}
+
+	message := "missing " + strings.Join(missing, ", ")
+	for _, name := range missing {
+		if name == "extension vector" || contains(coreTables, name) {
+			return types.DatabaseHealth{Status: StatusUnhealthy, Message: message}
+		}
+	}
+
+	return types.DatabaseHealth{Status: StatusDegraded, Message: message}
+}
+
+func (c *Checker) checkEmbedding(ctx context.Context) types.EmbeddingHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.probedAt.IsZero() && time.Since(c.probedAt) < c.probeTTL {
+		return c.lastProbe
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	result := types.EmbeddingHealth{Status: StatusHealthy, Message: "reachable"}
+	if _, err := c.embedClient.GenerateEmbedding(probeCtx, probeText); err != nil {
+		// A probe cut short by the caller says nothing about the provider.
+		if ctx.Err() != nil {
+			return types.EmbeddingHealth{Status: StatusDegraded, Message: "probe cancelled"}
+		}
+		result = types.EmbeddingHealth{Status: StatusUnhealthy, Message: fmt.Sprintf("probe failed: %v", err)}
+	}
+
+	c.probedAt = time.Now()
+	c.lastProbe = result
+
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDB struct {
+	pingErr error
+	missing []string
+}
+
+func (d *fakeDB) HealthCheck(ctx context.Context) error {
+	return d.pingErr
+}
+
+func (d *fakeDB) MissingSchemaObjects(ctx context.Context, tables []string) ([]string, error) {
+	return d.missing, nil
+}
+
+type fakeEmbedClient struct {
+	err   error
+	calls int
+}
+
+func (c *fakeEmbedClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	c.calls++
+	return []float32{0.1}, c.err
+}
+
+func (c *fakeEmbedClient) GenerateEmbeddings(ctx context.Context, texts []string) (*embedding.Batch, error) {
+	return nil, c.err
+}
+
+func (c *fakeEmbedClient) GetQueryHash(text string) string {
+	return text
+}
+
+func TestChecker_Check(t *testing.T) {
+	tests := []struct {
+		name          string
+		db            *fakeDB
+		embedErr      error
+		wantStatus    string
+		wantDatabase  string
+		wantEmbedding string
+	}{
+		{"healthy", &fakeDB{}, nil, StatusHealthy, StatusHealthy, StatusHealthy},
+		{"database down", &fakeDB{pingErr: errors.New("refused")}, nil, StatusUnhealthy, StatusUnhealthy, StatusHealthy},
+		{"pgvector missing", &fakeDB{missing: []string{"extension vector"}}, nil, StatusUnhealthy, StatusUnhealthy, StatusHealthy},
+		{"core table missing", &fakeDB{missing: []string{"review_embeddings"}}, nil, StatusUnhealthy, StatusUnhealthy, StatusHealthy},
+		{"auxiliary table missing", &fakeDB{missing: []string{"rag_metrics"}}, nil, StatusDegraded, StatusDegraded, StatusHealthy},
+		{"embedding provider down", &fakeDB{}, errors.New("status 503"), StatusDegraded, StatusHealthy, StatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(tt.db, &fakeEmbedClient{err: tt.embedErr}, metrics.NewCollector(), "test", time.Minute)
+
+			response := checker.Check(context.Background())
+
+			assert.Equal(t, tt.wantStatus, response.Status)
+			assert.Equal(t, tt.wantDatabase, response.Database.Status)
+			assert.Equal(t, tt.wantEmbedding, response.Embedding.Status)
+			assert.Equal(t, "test", response.Version)
+			assert.Equal(t, "0", response.Metrics["total_queries"])
+		})
+	}
+}
+
+func TestChecker_CachesEmbeddingProbe(t *testing.T) {
+	client := &fakeEmbedClient{}
+	checker := NewChecker(&fakeDB{}, client, nil, "test", time.Minute)
+
+	checker.Check(context.Background())
+	checker.Check(context.Background())
+
+	assert.Equal(t, 1, client.calls)
+}
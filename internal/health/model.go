@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+)
+
+const modelProbeText = "embedding dimension check"
+
+// ModelStore is the part of storage.Repository the embedding model check
+// uses.
+type ModelStore interface {
+	VectorDimensions(ctx context.Context, table, column string) (int, error)
+	GetEmbeddingModel(ctx context.Context, table string) (model string, dimensions int, found bool, err error)
+	RecordEmbeddingModel(ctx context.Context, table, model string, dimensions int) error
+}
+
+type vectorColumn struct {
+	table  string
+	column string
+	// core columns are searched by every query, so a wrong dimension there
+	// makes the service unusable rather than degraded.
+	core bool
+}
+
+// embedding_cache is not listed: its vectors are kept per model and have no
+// fixed dimension.
+var vectorColumns = []vectorColumn{
+	{table: "review_embeddings", column: "content_vec", core: true},
+}
+
+// ModelMismatchError lists the ways the configured embedding model does not
+// fit the vectors already stored.
+type ModelMismatchError struct {
+	Problems []string
+	// Fatal is set when queries cannot run at all.
+	Fatal bool
+}
+
+func (e *ModelMismatchError) Error() string {
+	return "embedding model mismatch: " + strings.Join(e.Problems, "; ")
+}
+
+// VerifyEmbeddingModel embeds a probe string with client and compares its
+// dimension with the vector columns in the database, and model with the one
+// recorded for review_embeddings. The model is recorded the first time.
+// It returns a *ModelMismatchError on mismatch and other errors when the
+// check could not run.
+func VerifyEmbeddingModel(ctx context.Context, store ModelStore, client embedding.Client, model string) error {
+	probe, err := client.GenerateEmbedding(ctx, modelProbeText)
+	if err != nil {
+		return fmt.Errorf("failed to embed probe: %w", err)
+	}
+	dimensions := len(probe)
+
+	mismatch := &ModelMismatchError{}
+	for _, vc := range vectorColumns {
+		columnDimensions, err := store.VectorDimensions(ctx, vc.table, vc.column)
+		if err != nil {
+			return err
+		}
+		if columnDimensions != 0 && columnDimensions != dimensions {
+			mismatch.Problems = append(mismatch.Problems, fmt.Sprintf("%s.%s holds %d dimensions but %s produces %d",
+				vc.table, vc.column, columnDimensions, model, dimensions))
+			mismatch.Fatal = mismatch.Fatal || vc.core
+		}
+	}
+
+	const table = "review_embeddings"
+	recordedModel, recordedDimensions, found, err := store.GetEmbeddingModel(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !found && !mismatch.Fatal:
+		log.Printf("Recording %s (%d dimensions) as the model for %s", model, dimensions, table)
+		if err := store.RecordEmbeddingModel(ctx, table, model, dimensions); err != nil {
+			return err
+		}
+	case found && recordedModel != model:
+		mismatch.Problems = append(mismatch.Problems, fmt.Sprintf("%s was built with %s but %s is configured",
+			table, recordedModel, model))
+	case found && recordedDimensions != dimensions:
+		mismatch.Problems = append(mismatch.Problems, fmt.Sprintf("%s was built with %d dimensions but %s produces %d",
+			table, recordedDimensions, model, dimensions))
+		mismatch.Fatal = true
+	}
+
+	if len(mismatch.Problems) > 0 {
+		return mismatch
+	}
+
+	return nil
+}
+
+// RetryModelCheck runs VerifyEmbeddingModel every interval, each attempt
+// bounded by timeout, until the check runs, and reports its outcome on c:
+// a mismatch is reported as with SetModelMismatch. It is meant for a
+// service that started degraded because the check failed at startup.
+func (c *Checker) RetryModelCheck(ctx context.Context, store ModelStore, client embedding.Client, model string, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := VerifyEmbeddingModel(attemptCtx, store, client, model)
+		cancel()
+
+		var mismatch *ModelMismatchError
+		switch {
+		case err == nil:
+			log.Printf("Embedding model %s verified", model)
+		case errors.As(err, &mismatch):
+			log.Printf("Embedding model check found a mismatch: %v", err)
+			c.SetModelMismatch(mismatch)
+		default:
+			log.Printf("Embedding model check failed again: %v", err)
+			c.SetModelCheckError(err)
+			continue
+		}
+
+		c.SetModelCheckError(nil)
+		return
+	}
+}
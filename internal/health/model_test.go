@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeModelStore struct {
+	dimensions map[string]int
+	model      string
+	modelDims  int
+	recorded   []string
+}
+
+func (s *fakeModelStore) VectorDimensions(ctx context.Context, table, column string) (int, error) {
+	return s.dimensions[table+"."+column], nil
+}
+
+func (s *fakeModelStore) GetEmbeddingModel(ctx context.Context, table string) (string, int, bool, error) {
+	return s.model, s.modelDims, s.model != "", nil
+}
+
+func (s *fakeModelStore) RecordEmbeddingModel(ctx context.Context, table, model string, dimensions int) error {
+	s.recorded = append(s.recorded, table)
+	s.model, s.modelDims = model, dimensions
+	return nil
+}
+
+func TestVerifyEmbeddingModel(t *testing.T) {
+	matching := map[string]int{"review_embeddings.content_vec": 1, "embedding_cache.embedding_vector": 1}
+
+	t.Run("records model on first start", func(t *testing.T) {
+		store := &fakeModelStore{dimensions: matching}
+
+		require.NoError(t, VerifyEmbeddingModel(context.Background(), store, &fakeEmbedClient{}, "small"))
+		assert.Equal(t, []string{"review_embeddings"}, store.recorded)
+		assert.Equal(t, "small", store.model)
+
+		require.NoError(t, VerifyEmbeddingModel(context.Background(), store, &fakeEmbedClient{}, "small"))
+		assert.Len(t, store.recorded, 1)
+	})
+
+	t.Run("dimension mismatch is fatal", func(t *testing.T) {
+		store := &fakeModelStore{dimensions: map[string]int{"review_embeddings.content_vec": 1536}}
+
+		err := VerifyEmbeddingModel(context.Background(), store, &fakeEmbedClient{}, "small")
+
+		var mismatch *ModelMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.True(t, mismatch.Fatal)
+		assert.Contains(t, err.Error(), "review_embeddings.content_vec holds 1536 dimensions but small produces 1")
+		assert.Empty(t, store.recorded)
+	})
+
+	t.Run("model swap with same dimension degrades", func(t *testing.T) {
+		store := &fakeModelStore{dimensions: matching, model: "large", modelDims: 1}
+
+		err := VerifyEmbeddingModel(context.Background(), store, &fakeEmbedClient{}, "small")
+
+		var mismatch *ModelMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.False(t, mismatch.Fatal)
+		assert.Contains(t, err.Error(), "built with large but small is configured")
+	})
+}
+
+func TestChecker_ReportsModelMismatch(t *testing.T) {
+	checker := NewChecker(&fakeDB{}, &fakeEmbedClient{}, metrics.NewCollector(), "test", time.Minute)
+
+	checker.SetModelMismatch(&ModelMismatchError{Problems: []string{"swapped"}})
+	response := checker.Check(context.Background())
+	assert.Equal(t, StatusDegraded, response.Status)
+	assert.Equal(t, StatusDegraded, response.Embedding.Status)
+
+	checker.SetModelMismatch(&ModelMismatchError{Problems: []string{"wrong size"}, Fatal: true})
+	response = checker.Check(context.Background())
+	assert.Equal(t, StatusUnhealthy, response.Status)
+	assert.Equal(t, "embedding model mismatch: wrong size", response.Embedding.Message)
+}
+
+func TestChecker_RetriesModelCheck(t *testing.T) {
+	checker := NewChecker(&fakeDB{}, &fakeEmbedClient{}, metrics.NewCollector(), "test", time.Minute)
+	checker.SetModelCheckError(errors.New("provider unavailable"))
+
+	response := checker.Check(context.Background())
+	assert.Equal(t, StatusDegraded, response.Status)
+	assert.Equal(t, "embedding model not verified: provider unavailable", response.Embedding.Message)
+
+	store := &fakeModelStore{dimensions: map[string]int{"review_embeddings.content_vec": 1}, model: "large", modelDims: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	checker.RetryModelCheck(ctx, store, &fakeEmbedClient{}, "small", time.Millisecond, time.Second)
+
+	response = checker.Check(context.Background())
+	assert.Equal(t, StatusDegraded, response.Status)
+	assert.Equal(t, "embedding model mismatch: review_embeddings was built with large but small is configured", response.Embedding.Message)
+}
@@ -0,0 +1,163 @@
+package indexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/storage"
+)
+
+const defaultBatchSize = 100
+
+// Store is the part of storage.Repository the indexer uses.
+type Store interface {
+	PendingReviews(ctx context.Context, model, appID, afterID string, limit int) ([]storage.PendingReview, error)
+	UpsertReviewEmbeddings(ctx context.Context, model string, embeddings []storage.ReviewEmbedding) error
+	GetIndexCheckpoint(ctx context.Context, name string) (string, error)
+	SaveIndexCheckpoint(ctx context.Context, name, lastReviewID string) error
+}
+
+// Options select what a run indexes.
+type Options struct {
+	// AppID limits the run to one app; empty indexes every app.
+	AppID string
+	// Restart ignores the saved checkpoint and scans from the beginning.
+	Restart bool
+	// ShadowModel backfills the shadow embeddings of this model instead of
+	// review_embeddings. The client must produce embeddings of that model.
+	ShadowModel string
+}
+
+// Stats summarises a run.
+type Stats struct {
+	Indexed int
+	Batches int
+	Tokens  int
+}
+
+// Indexer embeds clean reviews that have no embedding, or whose content
+// changed since they were embedded, and upserts them into review_embeddings.
+type Indexer struct {
+	store       Store
+	embedClient embedding.Client
+	batchSize   int
+}
+
+func New(store Store, embedClient embedding.Client, batchSize int) *Indexer {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	return &Indexer{
+		store:       store,
+		embedClient: embedClient,
+		batchSize:   batchSize,
+	}
+}
+
+// Run scans reviews in ID order from the last checkpoint, saving a new one
+// after every batch so an interrupted run resumes where it stopped. A run
+// that reaches the end clears the checkpoint for the next one.
+func (ix *Indexer) Run(ctx context.Context, opts Options) (Stats, error) {
+	var stats Stats
+	name := checkpointName(opts)
+
+	afterID := ""
+	if !opts.Restart {
+		checkpoint, err := ix.store.GetIndexCheckpoint(ctx, name)
+		if err != nil {
+			return stats, err
+		}
+		afterID = checkpoint
+	}
+	if afterID != "" {
+		log.Printf("Resuming %s after review %s", name, afterID)
+	}
+
+	startTime := time.Now()
+	for {
+		reviews, err := ix.store.PendingReviews(ctx, opts.ShadowModel, opts.AppID, afterID, ix.batchSize)
+		if err != nil {
+			return stats, err
+		}
+		if len(reviews) == 0 {
+			break
+		}
+
+		tokens, err := ix.indexBatch(ctx, opts.ShadowModel, reviews)
+		if err != nil {
+			return stats, err
+		}
+
+		afterID = reviews[len(reviews)-1].ID
+		if err := ix.store.SaveIndexCheckpoint(ctx, name, afterID); err != nil {
+			return stats, err
+		}
+
+		stats.Indexed += len(reviews)
+		stats.Batches++
+		stats.Tokens += tokens
+
+		elapsed := time.Since(startTime)
+		log.Printf("Indexed %d reviews in %d batches (%.1f reviews/s, %d tokens), last review %s",
+			stats.Indexed, stats.Batches, float64(stats.Indexed)/elapsed.Seconds(), stats.Tokens, afterID)
+	}
+
+	if err := ix.store.SaveIndexCheckpoint(ctx, name, ""); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (ix *Indexer) indexBatch(ctx context.Context, model string, reviews []storage.PendingReview) (int, error) {
+	texts := make([]string, len(reviews))
+	for i, review := range reviews {
+		texts[i] = review.Content
+	}
+
+	batch, err := ix.embedClient.GenerateEmbeddings(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed reviews: %w", err)
+	}
+
+	embeddings := make([]storage.ReviewEmbedding, len(reviews))
+	for i, review := range reviews {
+		embeddings[i] = storage.ReviewEmbedding{
+			ReviewID:    review.ID,
+			AppID:       review.AppID,
+			Rating:      review.Rating,
+			Country:     review.Country,
+			Embedding:   batch.Embeddings[i],
+			ContentHash: contentHash(review.Content),
+		}
+	}
+
+	if err := ix.store.UpsertReviewEmbeddings(ctx, model, embeddings); err != nil {
+		return 0, err
+	}
+
+	return batch.TotalTokens, nil
+}
+
+func checkpointName(opts Options) string {
+	name := "review_embeddings"
+	if opts.ShadowModel != "" {
+		name = "review_embeddings_shadow:" + opts.ShadowModel
+	}
+	if opts.AppID != "" {
+		name += ":" + opts.AppID
+	}
+	return name
+}
+
+// contentHash must match the SQL in storage.PendingReviews.
+func contentHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
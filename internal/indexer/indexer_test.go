@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore treats a review as pending until it is upserted with the hash
+// of its current content.
+type memoryStore struct {
+	reviews     []storage.PendingReview
+	embedded    map[string]storage.ReviewEmbedding
+	checkpoints map[string]string
+	saved       []string
+}
+
+func newMemoryStore(reviews ...storage.PendingReview) *memoryStore {
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].ID < reviews[j].ID })
+	return &memoryStore{
+		reviews:     reviews,
+		embedded:    map[string]storage.ReviewEmbedding{},
+		checkpoints: map[string]string{},
+	}
+}
+
+func (s *memoryStore) PendingReviews(ctx context.Context, model, appID, afterID string, limit int) ([]storage.PendingReview, error) {
+	var pending []storage.PendingReview
+	for _, review := range s.reviews {
+		if review.ID <= afterID || (appID != "" && review.AppID != appID) {
+			continue
+		}
+		if e, ok := s.embedded[model+"/"+review.ID]; ok && e.ContentHash == contentHash(review.Content) {
+			continue
+		}
+		if len(pending) == limit {
+			break
+		}
+		pending = append(pending, review)
+	}
+	return pending, nil
+}
+
+func (s *memoryStore) UpsertReviewEmbeddings(ctx context.Context, model string, embeddings []storage.ReviewEmbedding) error {
+	for _, e := range embeddings {
+		s.embedded[model+"/"+e.ReviewID] = e
+	}
+	return nil
+}
+
+func (s *memoryStore) GetIndexCheckpoint(ctx context.Context, name string) (string, error) {
+	return s.checkpoints[name], nil
+}
+
+func (s *memoryStore) SaveIndexCheckpoint(ctx context.Context, name, lastReviewID string) error {
+	s.checkpoints[name] = lastReviewID
+	s.saved = append(s.saved, lastReviewID)
+	return nil
+}
+
+type fakeEmbedClient struct {
+	batches [][]string
+	failAt  int
+}
+
+func (c *fakeEmbedClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{float32(len(text))}, nil
+}
+
+func (c *fakeEmbedClient) GenerateEmbeddings(ctx context.Context, texts []string) (*embedding.Batch, error) {
+	c.batches = append(c.batches, texts)
+	if c.failAt > 0 && len(c.batches) == c.failAt {
+		return nil, errors.New("provider down")
+	}
+	batch := &embedding.Batch{TotalTokens: len(texts)}
+	for _, text := range texts {
+		batch.Embeddings = append(batch.Embeddings, []float32{float32(len(text))})
+	}
+	return batch, nil
+}
+
+func (c *fakeEmbedClient) GetQueryHash(text string) string {
+	return text
+}
+
+func TestIndexer_Run(t *testing.T) {
+	store := newMemoryStore(
+		storage.PendingReview{ID: "r1", AppID: "app", Content: "one"},
+		storage.PendingReview{ID: "r2", AppID: "app", Content: "two"},
+		storage.PendingReview{ID: "r3", AppID: "app", Content: "three"},
+	)
+	client := &fakeEmbedClient{}
+
+	stats, err := New(store, client, 2).Run(context.Background(), Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Indexed: 3, Batches: 2, Tokens: 3}, stats)
+	assert.Equal(t, [][]string{{"one", "two"}, {"three"}}, client.batches)
+	assert.Equal(t, []float32{5}, store.embedded["/r3"].Embedding)
+	assert.Equal(t, contentHash("three"), store.embedded["/r3"].ContentHash)
+	assert.Equal(t, []string{"r2", "r3", ""}, store.saved)
+
+	store.reviews[1].Content = "two, edited"
+
+	stats, err = New(store, client, 2).Run(context.Background(), Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Indexed)
+	assert.Equal(t, []string{"two, edited"}, client.batches[2])
+}
+
+func TestIndexer_ResumesFromCheckpoint(t *testing.T) {
+	store := newMemoryStore(
+		storage.PendingReview{ID: "r1", AppID: "app", Content: "one"},
+		storage.PendingReview{ID: "r2", AppID: "app", Content: "two"},
+		storage.PendingReview{ID: "r3", AppID: "app", Content: "three"},
+	)
+
+	_, err := New(store, &fakeEmbedClient{failAt: 2}, 1).Run(context.Background(), Options{AppID: "app"})
+	require.Error(t, err)
+	assert.Equal(t, "r1", store.checkpoints["review_embeddings:app"])
+
+	client := &fakeEmbedClient{}
+	stats, err := New(store, client, 1).Run(context.Background(), Options{AppID: "app"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Indexed)
+	assert.Equal(t, [][]string{{"two"}, {"three"}}, client.batches)
+	assert.Empty(t, store.checkpoints["review_embeddings:app"])
+}
+
+func TestIndexer_BackfillsShadowModelSeparately(t *testing.T) {
+	store := newMemoryStore(
+		storage.PendingReview{ID: "r1", AppID: "app", Content: "one"},
+		storage.PendingReview{ID: "r2", AppID: "app", Content: "two"},
+	)
+
+	_, err := New(store, &fakeEmbedClient{}, 10).Run(context.Background(), Options{})
+	require.NoError(t, err)
+
+	stats, err := New(store, &fakeEmbedClient{}, 10).Run(context.Background(), Options{ShadowModel: "large"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Indexed)
+	assert.Contains(t, store.embedded, "large/r1")
+	assert.Contains(t, store.checkpoints, "review_embeddings_shadow:large")
+}
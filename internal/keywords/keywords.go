@@ -0,0 +1,95 @@
+// Package keywords pulls salient terms out of review text without any
+// external service.
+package keywords
+
+import (
+	"sort"
+
+	"github.com/quiby-ai/review-rag/internal/terms"
+)
+
+// minDocuments is how many documents of a group must mention a term for it
+// to count as one of the group's themes.
+const minDocuments = 2
+
+// themeTerms drops short tokens such as "ok" or "ui" that rarely carry a
+// theme on their own.
+var themeTerms = terms.Options{MinLength: 3}
+
+// Distinctive returns up to n themes for each group of documents: terms
+// mentioned by a larger share of the group's documents than of the other
+// groups' documents, most distinctive first. A term must appear in at least
+// two of the group's documents, or in its only document.
+func Distinctive(groups [][]string, n int) [][]string {
+	frequencies := make([]map[string]int, len(groups))
+	totals := make(map[string]int)
+	documents := 0
+
+	for i, group := range groups {
+		frequencies[i] = documentFrequencies(group)
+		for term, count := range frequencies[i] {
+			totals[term] += count
+		}
+		documents += len(group)
+	}
+
+	result := make([][]string, len(groups))
+	for i, group := range groups {
+		result[i] = []string{}
+		if len(group) == 0 {
+			continue
+		}
+
+		required := min(minDocuments, len(group))
+		otherDocuments := documents - len(group)
+
+		type scored struct {
+			term  string
+			score float64
+		}
+		var candidates []scored
+
+		for term, count := range frequencies[i] {
+			if count < required {
+				continue
+			}
+
+			share := float64(count) / float64(len(group))
+			otherShare := 0.0
+			if otherDocuments > 0 {
+				otherShare = float64(totals[term]-count) / float64(otherDocuments)
+			}
+
+			if share > otherShare {
+				candidates = append(candidates, scored{term: term, score: share - otherShare})
+			}
+		}
+
+		sort.Slice(candidates, func(a, b int) bool {
+			if candidates[a].score != candidates[b].score {
+				return candidates[a].score > candidates[b].score
+			}
+			return candidates[a].term < candidates[b].term
+		})
+
+		for _, candidate := range candidates {
+			if len(result[i]) == n {
+				break
+			}
+			result[i] = append(result[i], candidate.term)
+		}
+	}
+
+	return result
+}
+
+// documentFrequencies counts, for every term, the documents mentioning it.
+func documentFrequencies(documents []string) map[string]int {
+	frequencies := make(map[string]int)
+	for _, document := range documents {
+		for _, term := range terms.Extract(document, themeTerms) {
+			frequencies[term]++
+		}
+	}
+	return frequencies
+}
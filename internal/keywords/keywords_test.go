@@ -0,0 +1,32 @@
+package keywords
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinctive(t *testing.T) {
+	ours := []string{
+		"Onboarding tutorial is way too long",
+		"The tutorial never ends, onboarding takes forever",
+		"Sign up was quick",
+	}
+	theirs := []string{
+		"Sign up asks for my phone number",
+		"Why does sign up need my phone number?",
+		"Quick onboarding",
+	}
+
+	themes := Distinctive([][]string{ours, theirs}, 3)
+
+	assert.Equal(t, []string{"tutorial", "onboarding"}, themes[0])
+	assert.Equal(t, []string{"number", "phone", "sign"}, themes[1])
+}
+
+func TestDistinctive_EmptyGroup(t *testing.T) {
+	themes := Distinctive([][]string{{"Crashes on launch"}, nil}, 5)
+
+	assert.Equal(t, []string{"crashes", "launch"}, themes[0])
+	assert.Equal(t, []string{}, themes[1])
+}
@@ -0,0 +1,350 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// Sink persists rolled-up aggregates. RecordMetrics writes all of metrics or,
+// on error, none of them.
+type Sink interface {
+	RecordMetrics(ctx context.Context, metrics []types.Metric) error
+}
+
+type rollupStats struct {
+	queries          int
+	totalTimeMs      float64
+	totalConfidence  float64
+	totalResults     int
+	retrievals       int
+	totalRetrievalMs float64
+}
+
+func (s *rollupStats) add(other *rollupStats) {
+	s.queries += other.queries
+	s.totalTimeMs += other.totalTimeMs
+	s.totalConfidence += other.totalConfidence
+	s.totalResults += other.totalResults
+	s.retrievals += other.retrievals
+	s.totalRetrievalMs += other.totalRetrievalMs
+}
+
+type embeddingStats struct {
+	calls       int
+	totalTimeMs float64
+}
+
+// rollupBatch holds aggregates that have been taken out of the window but
+// not yet written to the sink. The sink writes a batch as a whole, so a
+// failed rollup keeps all of it for the next one.
+type rollupBatch struct {
+	apps       map[string]*rollupStats
+	global     rollupStats
+	embeddings embeddingStats
+}
+
+const (
+	// maxAppLabels caps the distinct app_id label values exported to
+	// Prometheus; apps seen after the cap is reached share otherAppLabel.
+	maxAppLabels  = 100
+	otherAppLabel = "other"
+)
+
+// Collector tracks RAG pipeline measurements, exposes them in Prometheus
+// text format and periodically rolls them up into a Sink. All methods are
+// safe to call on a nil Collector, which records nothing.
+type Collector struct {
+	mu sync.Mutex
+
+	queryDuration     *histogramVec
+	embeddingDuration *histogramVec
+	retrievalDuration *histogramVec
+	resultCount       *histogramVec
+	confidence        *histogramVec
+	errors            *counterVec
+	funcs             []funcMetric
+
+	appLabels map[string]struct{}
+
+	window          map[string]*rollupStats
+	embeddingWindow embeddingStats
+	pending         *rollupBatch
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		queryDuration:     newHistogramVec("rag_query_duration_seconds", "End-to-end RAG query latency.", "app_id", latencyBuckets),
+		embeddingDuration: newHistogramVec("rag_embedding_duration_seconds", "Query embedding latency.", "", latencyBuckets),
+		retrievalDuration: newHistogramVec("rag_retrieval_duration_seconds", "Database retrieval latency.", "app_id", latencyBuckets),
+		resultCount:       newHistogramVec("rag_query_results", "Number of reviews retrieved per query.", "app_id", resultBuckets),
+		confidence:        newHistogramVec("rag_query_confidence", "Answer confidence per query.", "app_id", confidenceBuckets),
+		errors:            newCounterVec("rag_query_errors_total", "Failed queries by pipeline stage.", "stage"),
+		appLabels:         make(map[string]struct{}),
+		window:            make(map[string]*rollupStats),
+	}
+}
+
+// appLabel returns the Prometheus label value for appID, folding apps
+// beyond the first maxAppLabels into otherAppLabel.
+func (c *Collector) appLabel(appID string) string {
+	if _, ok := c.appLabels[appID]; ok {
+		return appID
+	}
+	if len(c.appLabels) >= maxAppLabels {
+		return otherAppLabel
+	}
+	c.appLabels[appID] = struct{}{}
+	return appID
+}
+
+func (c *Collector) ObserveQuery(appID string, duration time.Duration, results int, confidence float64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	label := c.appLabel(appID)
+	c.queryDuration.observe(label, duration.Seconds())
+	c.resultCount.observe(label, float64(results))
+	c.confidence.observe(label, confidence)
+
+	stats := c.windowFor(appID)
+	stats.queries++
+	stats.totalTimeMs += float64(duration.Milliseconds())
+	stats.totalConfidence += confidence
+	stats.totalResults += results
+}
+
+func (c *Collector) ObserveEmbedding(duration time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.embeddingDuration.observe("", duration.Seconds())
+	c.embeddingWindow.calls++
+	c.embeddingWindow.totalTimeMs += float64(duration.Milliseconds())
+}
+
+func (c *Collector) ObserveRetrieval(appID string, duration time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retrievalDuration.observe(c.appLabel(appID), duration.Seconds())
+
+	stats := c.windowFor(appID)
+	stats.retrievals++
+	stats.totalRetrievalMs += float64(duration.Milliseconds())
+}
+
+func (c *Collector) windowFor(appID string) *rollupStats {
+	stats, ok := c.window[appID]
+	if !ok {
+		stats = &rollupStats{}
+		c.window[appID] = stats
+	}
+	return stats
+}
+
+func (c *Collector) ObserveError(stage string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errors.inc(stage)
+}
+
+// RegisterCounterFunc exposes a counter whose value is read from sample at
+// scrape time, e.g. cache hit counters owned by another component.
+func (c *Collector) RegisterCounterFunc(name, help string, sample func() float64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.funcs = append(c.funcs, funcMetric{name: name, help: help, kind: "counter", sample: sample})
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := c.WritePrometheus(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
+
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, vec := range []*histogramVec{c.queryDuration, c.embeddingDuration, c.retrievalDuration, c.resultCount, c.confidence} {
+		if err := vec.write(w); err != nil {
+			return err
+		}
+	}
+
+	if err := c.errors.write(w); err != nil {
+		return err
+	}
+
+	for _, m := range c.funcs {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Summary returns headline figures since startup, for the health endpoint.
+func (c *Collector) Summary() map[string]string {
+	summary := make(map[string]string)
+	if c == nil {
+		return summary
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var queries uint64
+	var totalSeconds, totalConfidence float64
+	for appID, h := range c.queryDuration.series {
+		queries += h.count
+		totalSeconds += h.sum
+		totalConfidence += c.confidence.series[appID].sum
+	}
+
+	var failed uint64
+	for _, count := range c.errors.series {
+		failed += count
+	}
+
+	summary["total_queries"] = fmt.Sprintf("%d", queries)
+	summary["failed_queries"] = fmt.Sprintf("%d", failed)
+	if queries > 0 {
+		summary["avg_query_time_ms"] = fmt.Sprintf("%.1f", totalSeconds*1000/float64(queries))
+		summary["avg_confidence_score"] = fmt.Sprintf("%.3f", totalConfidence/float64(queries))
+	}
+
+	return summary
+}
+
+// Rollup writes per-app and global aggregates for the queries observed since
+// the previous successful rollup. Aggregates that could not be written are
+// kept and retried, together with new observations, on the next rollup.
+func (c *Collector) Rollup(ctx context.Context, sink Sink) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	batch := c.pending
+	if batch == nil {
+		batch = &rollupBatch{apps: make(map[string]*rollupStats)}
+	}
+	for appID, stats := range c.window {
+		if pending, ok := batch.apps[appID]; ok {
+			pending.add(stats)
+		} else {
+			batch.apps[appID] = stats
+		}
+		batch.global.add(stats)
+	}
+	batch.embeddings.calls += c.embeddingWindow.calls
+	batch.embeddings.totalTimeMs += c.embeddingWindow.totalTimeMs
+	c.window = make(map[string]*rollupStats)
+	c.embeddingWindow = embeddingStats{}
+	c.pending = nil
+	c.mu.Unlock()
+
+	if err := c.flush(ctx, sink, batch); err != nil {
+		c.mu.Lock()
+		c.pending = batch
+		c.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (c *Collector) flush(ctx context.Context, sink Sink, batch *rollupBatch) error {
+	var metrics []types.Metric
+	for appID, stats := range batch.apps {
+		metrics = appendStats(metrics, stats, &appID)
+	}
+	metrics = appendStats(metrics, &batch.global, nil)
+
+	if batch.embeddings.calls > 0 {
+		value := batch.embeddings.totalTimeMs / float64(batch.embeddings.calls)
+		metrics = append(metrics, types.Metric{Name: "avg_embedding_time_ms", Value: value})
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+	if err := sink.RecordMetrics(ctx, metrics); err != nil {
+		return fmt.Errorf("failed to record metrics: %w", err)
+	}
+
+	return nil
+}
+
+func appendStats(metrics []types.Metric, stats *rollupStats, appID *string) []types.Metric {
+	if stats.queries > 0 {
+		n := float64(stats.queries)
+		metrics = append(metrics,
+			types.Metric{Name: "total_queries", Value: n, AppID: appID},
+			types.Metric{Name: "avg_query_time_ms", Value: stats.totalTimeMs / n, AppID: appID},
+			types.Metric{Name: "avg_confidence_score", Value: stats.totalConfidence / n, AppID: appID},
+			types.Metric{Name: "avg_result_count", Value: float64(stats.totalResults) / n, AppID: appID},
+		)
+	}
+
+	if stats.retrievals > 0 {
+		metrics = append(metrics, types.Metric{Name: "avg_retrieval_time_ms", Value: stats.totalRetrievalMs / float64(stats.retrievals), AppID: appID})
+	}
+
+	return metrics
+}
+
+// RunRollup calls Rollup every interval until ctx is done.
+func (c *Collector) RunRollup(ctx context.Context, sink Sink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Rollup(ctx, sink); err != nil && ctx.Err() == nil {
+				log.Printf("Metrics rollup failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedMetric struct {
+	name  string
+	value float64
+	appID string
+}
+
+type recordingSink struct {
+	metrics []recordedMetric
+	err     error
+}
+
+func (s *recordingSink) RecordMetrics(ctx context.Context, metrics []types.Metric) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, metric := range metrics {
+		m := recordedMetric{name: metric.Name, value: metric.Value}
+		if metric.AppID != nil {
+			m.appID = *metric.AppID
+		}
+		s.metrics = append(s.metrics, m)
+	}
+	return nil
+}
+
+func (s *recordingSink) find(name, appID string) (float64, bool) {
+	for _, m := range s.metrics {
+		if m.name == name && m.appID == appID {
+			return m.value, true
+		}
+	}
+	return 0, false
+}
+
+func TestCollector_WritePrometheus(t *testing.T) {
+	c := NewCollector()
+	c.ObserveQuery("com.test.app", 200*time.Millisecond, 5, 0.8)
+	c.ObserveEmbedding(30 * time.Millisecond)
+	c.ObserveRetrieval("com.test.app", 20*time.Millisecond)
+	c.ObserveError("embedding")
+	c.RegisterCounterFunc("rag_embedding_lru_hits_total", "LRU hits.", func() float64 { return 7 })
+
+	var out strings.Builder
+	require.NoError(t, c.WritePrometheus(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# TYPE rag_query_duration_seconds histogram")
+	assert.Contains(t, text, `rag_query_duration_seconds_bucket{app_id="com.test.app",le="0.1"} 0`)
+	assert.Contains(t, text, `rag_query_duration_seconds_bucket{app_id="com.test.app",le="0.25"} 1`)
+	assert.Contains(t, text, `rag_query_duration_seconds_bucket{app_id="com.test.app",le="+Inf"} 1`)
+	assert.Contains(t, text, `rag_query_duration_seconds_count{app_id="com.test.app"} 1`)
+	assert.Contains(t, text, `rag_embedding_duration_seconds_count 1`)
+	assert.Contains(t, text, `rag_query_results_sum{app_id="com.test.app"} 5`)
+	assert.Contains(t, text, `rag_query_errors_total{stage="embedding"} 1`)
+	assert.Contains(t, text, "rag_embedding_lru_hits_total 7")
+}
+
+func TestCollector_Rollup(t *testing.T) {
+	c := NewCollector()
+	c.ObserveQuery("app-a", 100*time.Millisecond, 4, 0.8)
+	c.ObserveQuery("app-a", 300*time.Millisecond, 6, 0.6)
+	c.ObserveQuery("app-b", 200*time.Millisecond, 5, 0.9)
+	c.ObserveEmbedding(40 * time.Millisecond)
+
+	sink := &recordingSink{}
+	require.NoError(t, c.Rollup(context.Background(), sink))
+
+	value, ok := sink.find("avg_query_time_ms", "app-a")
+	require.True(t, ok)
+	assert.InDelta(t, 200, value, 0.001)
+
+	value, ok = sink.find("total_queries", "")
+	require.True(t, ok)
+	assert.Equal(t, 3.0, value)
+
+	value, ok = sink.find("avg_confidence_score", "app-b")
+	require.True(t, ok)
+	assert.InDelta(t, 0.9, value, 0.001)
+
+	value, ok = sink.find("avg_embedding_time_ms", "")
+	require.True(t, ok)
+	assert.Equal(t, 40.0, value)
+
+	// The window is reset after each rollup.
+	sink = &recordingSink{}
+	require.NoError(t, c.Rollup(context.Background(), sink))
+	assert.Empty(t, sink.metrics)
+}
+
+func TestCollector_CapsAppLabels(t *testing.T) {
+	c := NewCollector()
+	for i := 0; i < maxAppLabels+5; i++ {
+		c.ObserveQuery(fmt.Sprintf("app-%d", i), time.Millisecond, 1, 1)
+	}
+	c.ObserveRetrieval("app-0", time.Millisecond)
+
+	assert.Len(t, c.queryDuration.series, maxAppLabels+1)
+	assert.Equal(t, uint64(5), c.queryDuration.series[otherAppLabel].count)
+	assert.Contains(t, c.retrievalDuration.series, "app-0")
+}
+
+func TestCollector_RollupKeepsWindowUntilWritten(t *testing.T) {
+	c := NewCollector()
+	c.ObserveQuery("app-a", 100*time.Millisecond, 4, 0.8)
+
+	sink := &recordingSink{err: errors.New("database unavailable")}
+	require.Error(t, c.Rollup(context.Background(), sink))
+
+	c.ObserveQuery("app-a", 300*time.Millisecond, 6, 0.6)
+
+	sink = &recordingSink{}
+	require.NoError(t, c.Rollup(context.Background(), sink))
+
+	value, ok := sink.find("total_queries", "app-a")
+	require.True(t, ok)
+	assert.Equal(t, 2.0, value)
+
+	value, ok = sink.find("avg_query_time_ms", "")
+	require.True(t, ok)
+	assert.InDelta(t, 200, value, 0.001)
+}
+
+func TestCollector_NilIsNoop(t *testing.T) {
+	var c *Collector
+	c.ObserveQuery("app", time.Second, 1, 1)
+	c.ObserveError("retrieval")
+	assert.NoError(t, c.Rollup(context.Background(), &recordingSink{}))
+	assert.Empty(t, c.Summary())
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	latencyBuckets    = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	resultBuckets     = []float64{0, 1, 2, 5, 10, 20, 50, 100}
+	confidenceBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+)
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	for i, upper := range buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// histogramVec is a histogram partitioned by at most one label.
+type histogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+	series  map[string]*histogram
+}
+
+func newHistogramVec(name, help, label string, buckets []float64) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		label:   label,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+}
+
+func (v *histogramVec) observe(labelValue string, value float64) {
+	h, ok := v.series[labelValue]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(v.buckets))}
+		v.series[labelValue] = h
+	}
+	h.observe(v.buckets, value)
+}
+
+func (v *histogramVec) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+
+	for _, labelValue := range sortedKeys(v.series) {
+		h := v.series[labelValue]
+		for i, upper := range v.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labels(labelValue, formatFloat(upper)), h.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labels(labelValue, "+Inf"), h.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", v.name, v.labels(labelValue, ""), formatFloat(h.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", v.name, v.labels(labelValue, ""), h.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *histogramVec) labels(labelValue, le string) string {
+	var pairs []string
+	if v.label != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, v.label, escapeLabel(labelValue)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// counterVec is a monotonically increasing counter partitioned by one label.
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	series map[string]uint64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		series: make(map[string]uint64),
+	}
+}
+
+func (v *counterVec) inc(labelValue string) {
+	v.series[labelValue]++
+}
+
+func (v *counterVec) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+
+	for _, labelValue := range sortedKeys(v.series) {
+		if _, err := fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", v.name, v.label, escapeLabel(labelValue), v.series[labelValue]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type funcMetric struct {
+	name   string
+	help   string
+	kind   string
+	sample func() float64
+}
+
+func (m funcMetric) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, m.help, m.name, m.kind, m.name, formatFloat(m.sample()))
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
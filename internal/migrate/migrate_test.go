@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/quiby-ai/review-rag/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_column.sql":        {Data: []byte("ALTER TABLE t ADD COLUMN c INT;")},
+		"001_create_table.sql":      {Data: []byte("CREATE TABLE t (id INT);")},
+		"001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"README.md":                 {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_table", Up: "CREATE TABLE t (id INT);", Down: "DROP TABLE t;"},
+		{Version: 2, Name: "add_column", Up: "ALTER TABLE t ADD COLUMN c INT;"},
+	}, migrations)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(fstest.MapFS{"001_orphan.down.sql": {Data: []byte("DROP TABLE t;")}})
+	assert.ErrorContains(t, err, "has no up file")
+
+	_, err = Load(fstest.MapFS{
+		"001_one.sql": {Data: []byte("SELECT 1;")},
+		"001_two.sql": {Data: []byte("SELECT 2;")},
+	})
+	assert.ErrorContains(t, err, "has files named")
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	files, err := fs.Sub(db.Migrations, "migrations")
+	require.NoError(t, err)
+
+	migrations, err := Load(files)
+
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration versions must be consecutive")
+		assert.NotEmpty(t, m.Down, "migration %d_%s has no down file", m.Version, m.Name)
+	}
+}
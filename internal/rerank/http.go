@@ -0,0 +1,128 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+type httpReranker struct {
+	httpClient *http.Client
+	endpoint   string
+	apiKey     string
+	model      string
+}
+
+// NewHTTPReranker returns a Reranker backed by a cross-encoder served over
+// the Cohere-style /rerank API (Cohere, Jina, vLLM). For
+// text-embeddings-inference use NewTEIReranker.
+func NewHTTPReranker(endpoint, apiKey, model string, timeout time.Duration) Reranker {
+	return &httpReranker{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		model:    model,
+	}
+}
+
+func (r *httpReranker) Rerank(ctx context.Context, query string, reviews []types.RetrievedReview) ([]types.RetrievedReview, error) {
+	if len(reviews) == 0 {
+		return reviews, nil
+	}
+
+	documents := make([]string, len(reviews))
+	for i, review := range reviews {
+		documents[i] = reviewDocument(review)
+	}
+
+	reqBody := types.RerankRequest{
+		Model:     r.model,
+		Query:     query,
+		Documents: documents,
+		TopN:      len(documents),
+	}
+
+	var rerankResp types.RerankResponse
+	if err := postRerank(ctx, r.httpClient, r.endpoint, r.apiKey, reqBody, &rerankResp); err != nil {
+		return nil, err
+	}
+
+	scores := make([]score, len(rerankResp.Results))
+	for i, result := range rerankResp.Results {
+		scores[i] = score{index: result.Index, value: result.RelevanceScore}
+	}
+
+	return applyScores(reviews, scores)
+}
+
+func postRerank(ctx context.Context, httpClient *http.Client, endpoint, apiKey string, body, out any) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rerank service returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// score is the relevance a rerank service gave the review at index.
+type score struct {
+	index int
+	value float64
+}
+
+// applyScores returns the scored reviews ordered by score. Reviews the
+// service did not score are dropped: a missing score says nothing about
+// relevance, so ranking them anywhere would be a guess.
+func applyScores(reviews []types.RetrievedReview, scores []score) ([]types.RetrievedReview, error) {
+	reranked := make([]types.RetrievedReview, 0, len(scores))
+	seen := make([]bool, len(reviews))
+
+	for _, s := range scores {
+		if s.index < 0 || s.index >= len(reviews) {
+			return nil, fmt.Errorf("rerank result index %d out of range", s.index)
+		}
+		if seen[s.index] {
+			continue
+		}
+		seen[s.index] = true
+
+		review := reviews[s.index]
+		review.RerankScore = s.value
+		reranked = append(reranked, review)
+	}
+
+	sortByScore(reranked)
+
+	return reranked, nil
+}
@@ -0,0 +1,55 @@
+package rerank
+
+import (
+	"context"
+
+	"github.com/quiby-ai/review-rag/internal/terms"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// lexicalWeight balances term overlap against the retrieval similarity.
+const lexicalWeight = 0.5
+
+// queryTerms keeps version numbers and error codes whole, since a query
+// naming one is after exactly that release or error.
+var queryTerms = terms.Options{KeepSymbols: true}
+
+type lexicalReranker struct{}
+
+// NewLexicalReranker returns a Reranker that needs no external service. It
+// scores each review by the share of query terms it contains, blended with
+// its retrieval similarity.
+func NewLexicalReranker() Reranker {
+	return &lexicalReranker{}
+}
+
+func (r *lexicalReranker) Rerank(ctx context.Context, query string, reviews []types.RetrievedReview) ([]types.RetrievedReview, error) {
+	wanted := terms.Extract(query, queryTerms)
+
+	reranked := make([]types.RetrievedReview, len(reviews))
+	copy(reranked, reviews)
+
+	for i := range reranked {
+		overlap := 0.0
+		if len(wanted) > 0 {
+			words := make(map[string]struct{})
+			for _, word := range terms.Extract(reviewDocument(reranked[i]), queryTerms) {
+				words[word] = struct{}{}
+			}
+
+			matched := 0
+			for _, term := range wanted {
+				if _, ok := words[term]; ok {
+					matched++
+				}
+			}
+			overlap = float64(matched) / float64(len(wanted))
+		}
+
+		reranked[i].RerankScore = lexicalWeight*overlap + (1-lexicalWeight)*reranked[i].Similarity
+	}
+
+	sortByScore(reranked)
+
+	return reranked, nil
+}
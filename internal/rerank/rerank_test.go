@@ -0,0 +1,134 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reviewIDs(reviews []types.RetrievedReview) []string {
+	ids := make([]string, len(reviews))
+	for i, review := range reviews {
+		ids[i] = review.ID
+	}
+	return ids
+}
+
+func TestHTTPReranker_Rerank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer rerank-key", r.Header.Get("Authorization"))
+
+		var req types.RerankRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "rerank-model", req.Model)
+		assert.Equal(t, "login problems", req.Query)
+		assert.Equal(t, []string{"Great\nLove it", "Can't log in since the update"}, req.Documents)
+		assert.Equal(t, 2, req.TopN)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"index":1,"relevance_score":0.92},{"index":0,"relevance_score":0.03}]}`))
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(server.URL, "rerank-key", "rerank-model", 5*time.Second)
+	reviews := []types.RetrievedReview{
+		{ID: "review-1", Title: "Great", Content: "Love it", Similarity: 0.9},
+		{ID: "review-2", Content: "Can't log in since the update", Similarity: 0.8},
+	}
+
+	reranked, err := reranker.Rerank(context.Background(), "login problems", reviews)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"review-2", "review-1"}, reviewIDs(reranked))
+	assert.Equal(t, 0.92, reranked[0].RerankScore)
+	assert.Equal(t, "review-1", reviews[0].ID, "input must not be reordered")
+}
+
+func TestHTTPReranker_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"status", http.StatusServiceUnavailable, "", "status 503"},
+		{"index out of range", http.StatusOK, `{"results":[{"index":5,"relevance_score":0.5}]}`, "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			reranker := NewHTTPReranker(server.URL, "", "", 5*time.Second)
+			_, err := reranker.Rerank(context.Background(), "query", []types.RetrievedReview{{ID: "review-1"}})
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestHTTPReranker_DropsUnscored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"index":1,"relevance_score":-2.5}]}`))
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(server.URL, "", "", 5*time.Second)
+	reranked, err := reranker.Rerank(context.Background(), "query", []types.RetrievedReview{{ID: "review-1"}, {ID: "review-2"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"review-2"}, reviewIDs(reranked))
+}
+
+func TestTEIReranker_Rerank(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rerank", r.URL.Path)
+
+		var req types.TEIRerankRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "login problems", req.Query)
+		assert.Equal(t, []string{"Great\nLove it", "Can't log in since the update"}, req.Texts)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"index":1,"score":0.92},{"index":0,"score":0.03}]`))
+	}))
+	defer server.Close()
+
+	reranker := NewTEIReranker(server.URL+"/", "", 5*time.Second)
+	reviews := []types.RetrievedReview{
+		{ID: "review-1", Title: "Great", Content: "Love it", Similarity: 0.9},
+		{ID: "review-2", Content: "Can't log in since the update", Similarity: 0.8},
+	}
+
+	reranked, err := reranker.Rerank(context.Background(), "login problems", reviews)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"review-2", "review-1"}, reviewIDs(reranked))
+	assert.Equal(t, 0.92, reranked[0].RerankScore)
+}
+
+func TestLexicalReranker_Rerank(t *testing.T) {
+	reviews := []types.RetrievedReview{
+		{ID: "review-1", Content: "Nice design overall", Similarity: 0.85},
+		{ID: "review-2", Content: "Error E-1234 when I try to login on v2.3.1", Similarity: 0.7},
+		{ID: "review-3", Content: "Login is slow", Similarity: 0.75},
+	}
+
+	reranked, err := NewLexicalReranker().Rerank(context.Background(), "What do users say about login error E-1234?", reviews)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"review-2", "review-3", "review-1"}, reviewIDs(reranked))
+}
@@ -0,0 +1,27 @@
+package rerank
+
+import (
+	"context"
+	"sort"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// Reranker re-scores retrieved candidates against the query. It returns the
+// reviews ordered by RerankScore, best first.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, reviews []types.RetrievedReview) ([]types.RetrievedReview, error)
+}
+
+func sortByScore(reviews []types.RetrievedReview) {
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].RerankScore > reviews[j].RerankScore
+	})
+}
+
+func reviewDocument(review types.RetrievedReview) string {
+	if review.Title == "" {
+		return review.Content
+	}
+	return review.Title + "\n" + review.Content
+}
@@ -0,0 +1,58 @@
+package rerank
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+type teiReranker struct {
+	httpClient *http.Client
+	endpoint   string
+	apiKey     string
+}
+
+// NewTEIReranker returns a Reranker backed by a HuggingFace
+// text-embeddings-inference server hosting a cross-encoder. endpoint is the
+// server's base URL. The server hosts a single model, so none is sent.
+func NewTEIReranker(endpoint, apiKey string, timeout time.Duration) Reranker {
+	return &teiReranker{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint: strings.TrimRight(endpoint, "/") + "/rerank",
+		apiKey:   apiKey,
+	}
+}
+
+func (r *teiReranker) Rerank(ctx context.Context, query string, reviews []types.RetrievedReview) ([]types.RetrievedReview, error) {
+	if len(reviews) == 0 {
+		return reviews, nil
+	}
+
+	texts := make([]string, len(reviews))
+	for i, review := range reviews {
+		texts[i] = reviewDocument(review)
+	}
+
+	reqBody := types.TEIRerankRequest{
+		Query:    query,
+		Texts:    texts,
+		Truncate: true,
+	}
+
+	var results []types.TEIRerankResult
+	if err := postRerank(ctx, r.httpClient, r.endpoint, r.apiKey, reqBody, &results); err != nil {
+		return nil, err
+	}
+
+	scores := make([]score, len(results))
+	for i, result := range results {
+		scores[i] = score{index: result.Index, value: result.Score}
+	}
+
+	return applyScores(reviews, scores)
+}
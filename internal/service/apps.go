@@ -0,0 +1,133 @@
+package service
+
+import (
+	"github.com/quiby-ai/review-rag/internal/storage"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// breakdownTopReviews is how many review IDs each app's breakdown lists.
+const breakdownTopReviews = 3
+
+// multiAppLabel is the metrics label of queries spanning several apps, so
+// that app combinations do not each create their own series.
+const multiAppLabel = "multi"
+
+func metricsLabel(apps []string) string {
+	if len(apps) == 1 {
+		return apps[0]
+	}
+	return multiAppLabel
+}
+
+// logQuery records a query once per app it covered, with that app's share
+// of the retrieved reviews as its result count.
+func (s *RAGService) logQuery(apps []string, queryHash, queryText string, processingTime float64, reviews []types.RetrievedReview, confidence float64) {
+	counts := make(map[string]int, len(apps))
+	for _, review := range reviews {
+		counts[review.AppID]++
+	}
+
+	for _, app := range apps {
+		resultCount := counts[app]
+		if len(apps) == 1 {
+			resultCount = len(reviews)
+		}
+
+		s.queryLogger.Log(storage.QueryLogEntry{
+			QueryHash:        queryHash,
+			AppID:            app,
+			QueryText:        queryText,
+			ProcessingTimeMs: int(processingTime * 1000),
+			ResultCount:      resultCount,
+			Confidence:       confidence,
+		})
+	}
+}
+
+// appQuota splits limit evenly across apps, rounding up so the quotas
+// always add up to at least limit. A single app gets no quota.
+func appQuota(limit, apps int) int {
+	if apps <= 1 {
+		return 0
+	}
+	return (limit + apps - 1) / apps
+}
+
+// applyAppQuota keeps the first k ranked reviews, taking at most quota from
+// each app. Slots left over because some app ran short go to the best of the
+// passed-over reviews. Ranking order is preserved.
+func applyAppQuota(ranked []types.RetrievedReview, k, quota int) []types.RetrievedReview {
+	if len(ranked) <= k {
+		return ranked
+	}
+	if quota <= 0 {
+		return ranked[:k]
+	}
+
+	keep := make([]bool, len(ranked))
+	perApp := make(map[string]int)
+	kept := 0
+
+	for i, review := range ranked {
+		if kept == k {
+			break
+		}
+		if perApp[review.AppID] < quota {
+			keep[i] = true
+			perApp[review.AppID]++
+			kept++
+		}
+	}
+
+	for i := range ranked {
+		if kept == k {
+			break
+		}
+		if !keep[i] {
+			keep[i] = true
+			kept++
+		}
+	}
+
+	result := make([]types.RetrievedReview, 0, k)
+	for i, review := range ranked {
+		if keep[i] {
+			result = append(result, review)
+		}
+	}
+
+	return result
+}
+
+// appBreakdowns summarises reviews per app, in the order apps were asked
+// for. Apps without any retrieved review are listed with a zero count.
+func appBreakdowns(apps []string, reviews []types.RetrievedReview) []types.AppBreakdown {
+	breakdowns := make([]types.AppBreakdown, len(apps))
+	index := make(map[string]int, len(apps))
+	ratingSums := make([]int, len(apps))
+
+	for i, app := range apps {
+		breakdowns[i] = types.AppBreakdown{AppID: app, TopReviewIDs: []string{}}
+		index[app] = i
+	}
+
+	for _, review := range reviews {
+		i, ok := index[review.AppID]
+		if !ok {
+			continue
+		}
+		breakdowns[i].ReviewCount++
+		ratingSums[i] += int(review.Rating)
+		if len(breakdowns[i].TopReviewIDs) < breakdownTopReviews {
+			breakdowns[i].TopReviewIDs = append(breakdowns[i].TopReviewIDs, review.ID)
+		}
+	}
+
+	for i := range breakdowns {
+		if breakdowns[i].ReviewCount > 0 {
+			breakdowns[i].AverageRating = float64(ratingSums[i]) / float64(breakdowns[i].ReviewCount)
+		}
+	}
+
+	return breakdowns
+}
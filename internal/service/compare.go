@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/keywords"
+	"github.com/quiby-ai/review-rag/internal/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// representativeReviews is how many of each app's best matching reviews
+	// a comparison returns.
+	representativeReviews = 3
+	// distinctThemes caps the themes listed per app.
+	distinctThemes = 5
+)
+
+// Compare answers one question for several apps side by side. Each app is
+// retrieved on its own, so every app contributes its best matching reviews
+// to the answer however many reviews the others have.
+func (s *RAGService) Compare(ctx context.Context, request types.CompareRequest) (*types.CompareResponse, error) {
+	startTime := time.Now()
+	embedClient, model := s.embeddingTarget()
+
+	embedStart := time.Now()
+	queryEmbedding, err := embedClient.GenerateEmbedding(ctx, request.Query)
+	if err != nil {
+		s.metrics.ObserveError("embedding")
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+	s.metrics.ObserveEmbedding(time.Since(embedStart))
+
+	retrievalStart := time.Now()
+	perApp := make([][]types.RetrievedReview, len(request.AppIDs))
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i, appID := range request.AppIDs {
+		g.Go(func() error {
+			query := types.RAGQuery{Query: request.Query, AppID: appID, Filters: request.Filters}
+			reviews, err := s.retrieve(gctx, query, queryEmbedding, model)
+			if err != nil {
+				return err
+			}
+			perApp[i] = reviews
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		s.metrics.ObserveError("retrieval")
+		return nil, fmt.Errorf("failed to retrieve reviews: %w", err)
+	}
+
+	s.metrics.ObserveRetrieval(metricsLabel(request.AppIDs), time.Since(retrievalStart))
+
+	var reviews []types.RetrievedReview
+	for _, appReviews := range perApp {
+		reviews = append(reviews, appReviews...)
+	}
+
+	response := &types.CompareResponse{
+		Answer:    "No relevant reviews found for your query.",
+		Citations: []types.Citation{},
+		Apps:      compareApps(request.AppIDs, perApp),
+		QueryHash: s.embedClient.GetQueryHash(request.Query),
+	}
+
+	if len(reviews) > 0 {
+		answer, citations, unverified, err := s.generate(ctx, comparisonQuestion(request.Query, request.AppIDs), reviews, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Answer = answer
+		response.Citations = citations
+		response.UnverifiedCitations = unverified
+		response.Confidence = s.calculateConfidence(reviews)
+	}
+
+	response.ProcessingTime = time.Since(startTime).Seconds()
+
+	s.metrics.ObserveQuery(metricsLabel(request.AppIDs), time.Since(startTime), len(reviews), response.Confidence)
+
+	s.logQuery(request.AppIDs, response.QueryHash, request.Query, response.ProcessingTime, reviews, response.Confidence)
+
+	return response, nil
+}
+
+// comparisonQuestion asks the generator for a side-by-side answer. Reviews
+// carry their app id in the prompt, so the apps are named by id.
+func comparisonQuestion(query string, appIDs []string) string {
+	return fmt.Sprintf("Compare the apps %s. For each app in turn, answer: %s Then point out where their users disagree.",
+		strings.Join(appIDs, ", "), query)
+}
+
+// compareApps summarises each app's retrieved reviews and the themes that
+// set them apart from the other apps'.
+func compareApps(appIDs []string, perApp [][]types.RetrievedReview) []types.AppComparison {
+	documents := make([][]string, len(perApp))
+	for i, reviews := range perApp {
+		documents[i] = make([]string, len(reviews))
+		for j, review := range reviews {
+			documents[i][j] = review.Title + "\n" + review.Content
+		}
+	}
+	themes := keywords.Distinctive(documents, distinctThemes)
+
+	comparisons := make([]types.AppComparison, len(appIDs))
+	for i, appID := range appIDs {
+		reviews := perApp[i]
+		comparison := types.AppComparison{
+			AppID:                 appID,
+			ReviewCount:           len(reviews),
+			Sentiment:             "unknown",
+			RepresentativeReviews: append([]types.RetrievedReview{}, reviews[:min(len(reviews), representativeReviews)]...),
+			DistinctThemes:        themes[i],
+		}
+
+		if len(reviews) > 0 {
+			var sum, positive, negative int
+			for _, review := range reviews {
+				sum += int(review.Rating)
+				switch {
+				case review.Rating >= 4:
+					positive++
+				case review.Rating <= 2:
+					negative++
+				}
+			}
+
+			count := float64(len(reviews))
+			comparison.AverageRating = float64(sum) / count
+			comparison.PositiveShare = float64(positive) / count
+			comparison.NegativeShare = float64(negative) / count
+			comparison.Sentiment = sentimentLabel(comparison.PositiveShare, comparison.NegativeShare)
+		}
+
+		comparisons[i] = comparison
+	}
+
+	return comparisons
+}
+
+// sentimentLabel calls a clear majority of positive or negative reviews;
+// anything else is mixed.
+func sentimentLabel(positiveShare, negativeShare float64) string {
+	switch {
+	case positiveShare > 0.6:
+		return "positive"
+	case negativeShare > 0.6:
+		return "negative"
+	default:
+		return "mixed"
+	}
+}
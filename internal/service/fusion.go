@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const defaultRRFK = 60
+
+// fuseRankings merges ranked lists with reciprocal rank fusion: each review
+// scores the sum of 1/(k+rank) over the lists it appears in. The top limit
+// reviews are returned, best first.
+func fuseRankings(k, limit int, rankings ...[]types.RetrievedReview) []types.RetrievedReview {
+	if k <= 0 {
+		k = defaultRRFK
+	}
+
+	scores := make(map[string]float64)
+	reviews := make(map[string]types.RetrievedReview)
+	var order []string
+
+	for _, ranking := range rankings {
+		for rank, review := range ranking {
+			if _, ok := reviews[review.ID]; !ok {
+				reviews[review.ID] = review
+				order = append(order, review.ID)
+			}
+			scores[review.ID] += 1.0 / float64(k+rank+1)
+		}
+	}
+
+	// A stable sort keeps first-seen order on ties, which favours the
+	// earlier (vector) ranking.
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	if limit > 0 && len(order) > limit {
+		order = order[:limit]
+	}
+
+	fused := make([]types.RetrievedReview, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, reviews[id])
+	}
+
+	return fused
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"math"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// diversify picks k reviews by Maximal Marginal Relevance: each step takes
+// the candidate maximising lambda*relevance - (1-lambda)*redundancy, where
+// redundancy is the highest cosine similarity to an already picked review.
+// Candidates must be ordered best first; relevance is their similarity to the
+// query, or their normalised rerank score when reranked is set. A positive
+// quota caps the picks per app for as long as other apps have candidates left.
+func diversify(candidates []types.RetrievedReview, k, quota int, lambda float64, reranked bool) []types.RetrievedReview {
+	if k <= 0 || len(candidates) <= k {
+		return candidates
+	}
+
+	for _, candidate := range candidates {
+		if len(candidate.Embedding) == 0 {
+			return applyAppQuota(candidates, k, quota)
+		}
+	}
+
+	relevance := relevanceScores(candidates, reranked)
+
+	selected := make([]int, 0, k)
+	used := make([]bool, len(candidates))
+	// maxSim[i] is candidate i's highest similarity to any selected review.
+	maxSim := make([]float64, len(candidates))
+	perApp := make(map[string]int)
+
+	for len(selected) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+
+		// Apps at their quota are passed over until nothing else is left.
+		for _, capped := range []bool{quota > 0, false} {
+			for i := range candidates {
+				if used[i] || capped && perApp[candidates[i].AppID] >= quota {
+					continue
+				}
+
+				redundancy := 0.0
+				if len(selected) > 0 {
+					redundancy = maxSim[i]
+				}
+
+				score := lambda*relevance[i] - (1-lambda)*redundancy
+				if score > bestScore {
+					best = i
+					bestScore = score
+				}
+			}
+			if best >= 0 {
+				break
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, best)
+		perApp[candidates[best].AppID]++
+
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			sim := cosineSimilarity(candidates[i].Embedding, candidates[best].Embedding)
+			if len(selected) == 1 || sim > maxSim[i] {
+				maxSim[i] = sim
+			}
+		}
+	}
+
+	result := make([]types.RetrievedReview, 0, k)
+	for _, i := range selected {
+		result = append(result, candidates[i])
+	}
+
+	return result
+}
+
+func relevanceScores(candidates []types.RetrievedReview, reranked bool) []float64 {
+	scores := make([]float64, len(candidates))
+	if !reranked {
+		for i, candidate := range candidates {
+			scores[i] = candidate.Similarity
+		}
+		return scores
+	}
+
+	// Rerank scores have no fixed range, so bring them to [0, 1] to keep
+	// them comparable with cosine similarity.
+	minScore, maxScore := math.Inf(1), math.Inf(-1)
+	for _, candidate := range candidates {
+		minScore = math.Min(minScore, candidate.RerankScore)
+		maxScore = math.Max(maxScore, candidate.RerankScore)
+	}
+
+	for i, candidate := range candidates {
+		if maxScore > minScore {
+			scores[i] = (candidate.RerankScore - minScore) / (maxScore - minScore)
+		} else {
+			scores[i] = 1
+		}
+	}
+
+	return scores
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/storage"
+)
+
+const queryLogWriteTimeout = 5 * time.Second
+
+// QueryLogger records queries in the background so that logging never adds
+// latency to a request. Entries are dropped when the buffer is full.
+type QueryLogger struct {
+	repo    storage.Repository
+	entries chan storage.QueryLogEntry
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewQueryLogger(repo storage.Repository, bufferSize int) *QueryLogger {
+	l := &QueryLogger{
+		repo:    repo,
+		entries: make(chan storage.QueryLogEntry, bufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l
+}
+
+// Log queues entry for writing. It is safe to call on a nil logger.
+func (l *QueryLogger) Log(entry storage.QueryLogEntry) {
+	if l == nil {
+		return
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+		log.Printf("Query log buffer full, dropping entry for app %s", entry.AppID)
+	}
+}
+
+// Close stops accepting entries and waits until the queued ones are written.
+func (l *QueryLogger) Close() {
+	l.once.Do(func() {
+		close(l.entries)
+	})
+	<-l.done
+}
+
+func (l *QueryLogger) run() {
+	defer close(l.done)
+
+	for entry := range l.entries {
+		ctx, cancel := context.WithTimeout(context.Background(), queryLogWriteTimeout)
+		if err := l.repo.LogQuery(ctx, entry); err != nil {
+			log.Printf("Failed to log query: %v", err)
+		}
+		cancel()
+	}
+}
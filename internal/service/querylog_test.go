@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quiby-ai/review-rag/internal/generation"
+	"github.com/quiby-ai/review-rag/internal/storage"
+	"github.com/quiby-ai/review-rag/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRAGService_Query_LogsQuery(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	logger := NewQueryLogger(mockRepo, 10)
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          20,
+		TopK:          5,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	}, WithQueryLogger(logger))
+
+	query := types.RAGQuery{
+		Query: "What do users think about the app?",
+		AppID: "com.test.app",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	expectedReviews := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9, Country: "US", Rating: 5},
+		{ID: "review-2", Similarity: 0.8, Country: "US", Rating: 4},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return(expectedReviews, nil)
+	mockRepo.On("LogQuery", mock.Anything, mock.MatchedBy(func(entry storage.QueryLogEntry) bool {
+		return entry.QueryHash == "test-hash-123" &&
+			entry.AppID == query.AppID &&
+			entry.QueryText == query.Query &&
+			entry.ResultCount == 2 &&
+			entry.Confidence > 0
+	})).Return(nil).Once()
+
+	_, err := service.Query(context.Background(), query)
+	assert.NoError(t, err)
+
+	logger.Close()
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Query_LogsEachApp(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	logger := NewQueryLogger(mockRepo, 10)
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          4,
+		TopK:          2,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	}, WithQueryLogger(logger))
+
+	query := types.RAGQuery{
+		Query:  "How stable is the app?",
+		AppIDs: []string{"com.big.app", "com.quiet.app"},
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 4, 2, query.AppIDs, query.Filters).Return([]types.RetrievedReview{
+		{ID: "big-1", AppID: "com.big.app", Rating: 1, Similarity: 0.95},
+	}, nil)
+	for app, count := range map[string]int{"com.big.app": 1, "com.quiet.app": 0} {
+		mockRepo.On("LogQuery", mock.Anything, mock.MatchedBy(func(entry storage.QueryLogEntry) bool {
+			return entry.AppID == app && entry.ResultCount == count
+		})).Return(nil).Once()
+	}
+
+	_, err := service.Query(context.Background(), query)
+	assert.NoError(t, err)
+
+	logger.Close()
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestQueryLogger_DropsWhenFull(t *testing.T) {
+	mockRepo := &MockRepository{}
+	logger := &QueryLogger{
+		repo:    mockRepo,
+		entries: make(chan storage.QueryLogEntry, 1),
+		done:    make(chan struct{}),
+	}
+
+	logger.Log(storage.QueryLogEntry{AppID: "first"})
+	logger.Log(storage.QueryLogEntry{AppID: "second"})
+
+	mockRepo.On("LogQuery", mock.Anything, storage.QueryLogEntry{AppID: "first"}).Return(nil).Once()
+
+	go logger.run()
+	logger.Close()
+
+	mockRepo.AssertExpectations(t)
+}
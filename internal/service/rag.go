@@ -3,18 +3,38 @@ package service
 import (
 	"context"
 	"fmt"
-	"strings"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/generation"
+	"github.com/quiby-ai/review-rag/internal/metrics"
+	"github.com/quiby-ai/review-rag/internal/rerank"
 	"github.com/quiby-ai/review-rag/internal/storage"
 	"github.com/quiby-ai/review-rag/internal/types"
+	"golang.org/x/sync/errgroup"
 )
 
 type RAGService struct {
 	embedClient embedding.Client
 	repo        storage.Repository
+	generator   generation.Generator
+	queryLogger *QueryLogger
+	metrics     *metrics.Collector
+	reranker    rerank.Reranker
 	config      RAGConfig
+	shadow      *shadowEmbeddings
+}
+
+// Option configures optional RAGService collaborators.
+type Option func(*RAGService)
+
+// WithQueryLogger records every query through logger.
+func WithQueryLogger(logger *QueryLogger) Option {
+	return func(s *RAGService) {
+		s.queryLogger = logger
+	}
 }
 
 type RAGConfig struct {
@@ -22,99 +42,401 @@ type RAGConfig struct {
 	TopK          int
 	ANNProbes     int
 	MinConfidence float64
+	// RetrievalMode is used when a query does not choose one.
+	RetrievalMode string
+	// RRFK is the rank offset of reciprocal rank fusion in hybrid mode.
+	RRFK int
+	// MMRLambda is the default relevance/diversity trade-off; 0 or 1
+	// disables diversification.
+	MMRLambda float64
+	// BatchConcurrency bounds the retrievals QueryBatch runs at once.
+	BatchConcurrency int
+	// BatchItemTimeout bounds each query of a QueryBatch, so that a slow
+	// item fails on its own instead of using up the whole batch's time.
+	// Zero means no limit beyond the batch's context.
+	BatchItemTimeout time.Duration
+	// SwitchToShadow moves retrieval to the shadow embeddings registered
+	// with WithShadowEmbeddings once every review has one.
+	SwitchToShadow bool
+	// ThemeSampleSize caps the recent reviews Themes clusters.
+	ThemeSampleSize int
+	// MaxThemes caps the themes found when the request does not set K.
+	MaxThemes int
+	// TrendMinSimilarity is the default similarity a review needs to count
+	// towards a trend.
+	TrendMinSimilarity float64
+	// TrendAnomalyZ is how many standard deviations above its baseline a
+	// trend bucket must be to be flagged.
+	TrendAnomalyZ float64
+}
+
+const defaultBatchConcurrency = 4
+
+// WithMetrics records pipeline latencies and results in collector.
+func WithMetrics(collector *metrics.Collector) Option {
+	return func(s *RAGService) {
+		s.metrics = collector
+	}
+}
+
+// WithReranker enables two-stage retrieval: TopN candidates are fetched and
+// reranked before being cut down to TopK.
+func WithReranker(reranker rerank.Reranker) Option {
+	return func(s *RAGService) {
+		s.reranker = reranker
+	}
 }
 
-func NewRAGService(embedClient embedding.Client, repo storage.Repository, config RAGConfig) *RAGService {
-	return &RAGService{
+func NewRAGService(embedClient embedding.Client, repo storage.Repository, generator generation.Generator, config RAGConfig, opts ...Option) *RAGService {
+	s := &RAGService{
 		embedClient: embedClient,
 		repo:        repo,
+		generator:   generator,
 		config:      config,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// StreamObserver receives intermediate results of QueryStream. Returning an
+// error from either callback aborts the query.
+type StreamObserver struct {
+	OnReviews func(reviews []types.RetrievedReview) error
+	OnToken   func(token string) error
 }
 
 func (s *RAGService) Query(ctx context.Context, query types.RAGQuery) (*types.RAGResponse, error) {
+	return s.query(ctx, query, nil)
+}
+
+// QueryStream runs the same pipeline as Query, reporting the retrieved reviews
+// as soon as they are available and the answer token by token.
+func (s *RAGService) QueryStream(ctx context.Context, query types.RAGQuery, observer StreamObserver) (*types.RAGResponse, error) {
+	return s.query(ctx, query, &observer)
+}
+
+func (s *RAGService) query(ctx context.Context, query types.RAGQuery, observer *StreamObserver) (*types.RAGResponse, error) {
 	startTime := time.Now()
+	embedClient, model := s.embeddingTarget()
 
-	queryEmbedding, err := s.embedClient.GenerateEmbedding(ctx, query.Query)
+	embedStart := time.Now()
+	queryEmbedding, err := embedClient.GenerateEmbedding(ctx, query.Query)
 	if err != nil {
+		s.metrics.ObserveError("embedding")
 		return nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
+	s.metrics.ObserveEmbedding(time.Since(embedStart))
+
+	return s.complete(ctx, query, queryEmbedding, model, startTime, observer, false)
+}
+
+// QueryBatch answers many queries with a single embedding call and runs
+// their retrievals with bounded concurrency. Failures, including running
+// past RAGConfig.BatchItemTimeout, are reported per item; an error is
+// returned only when the query texts could not be embedded. retrievalOnly
+// skips answer generation and returns just the retrieved reviews.
+func (s *RAGService) QueryBatch(ctx context.Context, queries []types.RAGQuery, retrievalOnly bool) ([]types.RAGBatchItem, error) {
+	texts := make([]string, 0, len(queries))
+	textIndex := make(map[string]int, len(queries))
+	for _, query := range queries {
+		if _, ok := textIndex[query.Query]; !ok {
+			textIndex[query.Query] = len(texts)
+			texts = append(texts, query.Query)
+		}
+	}
+
+	embedClient, model := s.embeddingTarget()
+
+	embedStart := time.Now()
+	batch, err := embedClient.GenerateEmbeddings(ctx, texts)
+	if err != nil {
+		s.metrics.ObserveError("embedding")
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	s.metrics.ObserveEmbedding(time.Since(embedStart))
+
+	concurrency := s.config.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	items := make([]types.RAGBatchItem, len(queries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, query := range queries {
+		items[i].Index = i
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				items[i].Error = ctx.Err().Error()
+				return
+			}
+
+			itemCtx := ctx
+			if s.config.BatchItemTimeout > 0 {
+				var cancel context.CancelFunc
+				itemCtx, cancel = context.WithTimeout(ctx, s.config.BatchItemTimeout)
+				defer cancel()
+			}
+
+			queryEmbedding := batch.Embeddings[textIndex[query.Query]]
+			response, err := s.complete(itemCtx, query, queryEmbedding, model, time.Now(), nil, retrievalOnly)
+			if err != nil {
+				items[i].Error = err.Error()
+				return
+			}
+			items[i].Response = response
+		}()
+	}
+
+	wg.Wait()
+
+	return items, nil
+}
 
-	retrievedReviews, err := s.repo.RAGRetrieval(
-		ctx,
-		queryEmbedding,
-		s.config.TopK,
-		query.AppID,
-	)
+// complete runs everything after embedding: retrieval, answer generation
+// unless retrievalOnly, metrics and query logging.
+func (s *RAGService) complete(ctx context.Context, query types.RAGQuery, queryEmbedding []float32, model string, startTime time.Time, observer *StreamObserver, retrievalOnly bool) (*types.RAGResponse, error) {
+	response, err := s.answer(ctx, query, queryEmbedding, model, startTime, observer, retrievalOnly)
 	if err != nil {
+		return nil, err
+	}
+
+	apps := query.Apps()
+	s.metrics.ObserveQuery(metricsLabel(apps), time.Since(startTime), len(response.RetrievedReviews), response.Confidence)
+
+	s.logQuery(apps, response.QueryHash, query.Query, response.ProcessingTime, response.RetrievedReviews, response.Confidence)
+
+	return response, nil
+}
+
+func (s *RAGService) answer(ctx context.Context, query types.RAGQuery, queryEmbedding []float32, model string, startTime time.Time, observer *StreamObserver, retrievalOnly bool) (*types.RAGResponse, error) {
+	retrievalStart := time.Now()
+	retrievedReviews, err := s.retrieve(ctx, query, queryEmbedding, model)
+	if err != nil {
+		s.metrics.ObserveError("retrieval")
 		return nil, fmt.Errorf("failed to retrieve reviews: %w", err)
 	}
+	s.metrics.ObserveRetrieval(metricsLabel(query.Apps()), time.Since(retrievalStart))
+
+	if observer != nil && observer.OnReviews != nil {
+		if err := observer.OnReviews(retrievedReviews); err != nil {
+			return nil, err
+		}
+	}
 
 	if len(retrievedReviews) == 0 {
 		return s.buildEmptyResponse(query, startTime), nil
 	}
 
-	answer := s.generateAnswer(query.Query, retrievedReviews)
+	var answer string
+	citations := []types.Citation{}
+	var unverified []string
+	if !retrievalOnly {
+		answer, citations, unverified, err = s.generate(ctx, query.Query, retrievedReviews, observer)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	confidence := s.calculateConfidence(retrievedReviews)
 
 	processingTime := time.Since(startTime).Milliseconds()
 
-	return &types.RAGResponse{
-		Answer:           answer,
-		RetrievedReviews: retrievedReviews,
-		Confidence:       confidence,
-		ProcessingTime:   float64(processingTime) / 1000.0,
-		QueryHash:        s.embedClient.GetQueryHash(query.Query),
-	}, nil
+	response := &types.RAGResponse{
+		Answer:              answer,
+		Citations:           citations,
+		UnverifiedCitations: unverified,
+		RetrievedReviews:    retrievedReviews,
+		Confidence:          confidence,
+		ProcessingTime:      float64(processingTime) / 1000.0,
+		QueryHash:           s.embedClient.GetQueryHash(query.Query),
+	}
+	if apps := query.Apps(); len(apps) > 1 {
+		response.Apps = appBreakdowns(apps, retrievedReviews)
+	}
+	if query.Themes {
+		response.Themes = s.retrievedThemes(retrievedReviews)
+	}
+	if query.ByVersion {
+		response.Versions = versionBreakdowns(retrievedReviews)
+	}
+
+	return response, nil
+}
+
+// generate answers question from reviews and keeps only the citations that
+// point at them.
+func (s *RAGService) generate(ctx context.Context, question string, reviews []types.RetrievedReview, observer *StreamObserver) (string, []types.Citation, []string, error) {
+	var answer string
+	var err error
+	if observer != nil && observer.OnToken != nil {
+		answer, err = s.generator.GenerateStream(ctx, question, reviews, observer.OnToken)
+	} else {
+		answer, err = s.generator.Generate(ctx, question, reviews)
+	}
+	if err != nil {
+		s.metrics.ObserveError("generation")
+		return "", nil, nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	answer, citations := generation.ExtractCitations(answer, reviews)
+	citations, unverified := validateCitations(citations, reviews)
+
+	return answer, citations, unverified, nil
+}
+
+// retrieve finds the reviews closest to queryEmbedding, which was produced
+// by model; an empty model means the primary embeddings. Across several
+// apps every app gets an equal share of the results, so one with many
+// reviews cannot crowd out the others.
+func (s *RAGService) retrieve(ctx context.Context, query types.RAGQuery, queryEmbedding []float32, model string) ([]types.RetrievedReview, error) {
+	lambda := s.mmrLambda(query)
+	apps := query.Apps()
+
+	candidates, err := s.retrieveCandidates(ctx, query, queryEmbedding, model, s.candidateCount(lambda, len(apps)))
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := false
+	if s.reranker != nil && len(candidates) > 0 {
+		results, err := s.reranker.Rerank(ctx, query.Query, candidates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			// Retrieval order is still a usable ranking.
+			s.metrics.ObserveError("rerank")
+			log.Printf("Reranking failed, keeping retrieval order: %v", err)
+		} else {
+			candidates = results
+			reranked = true
+		}
+	}
+
+	if lambda > 0 && lambda < 1 {
+		return diversify(candidates, s.config.TopK, appQuota(s.config.TopK, len(apps)), lambda, reranked), nil
+	}
+
+	return applyAppQuota(candidates, s.config.TopK, appQuota(s.config.TopK, len(apps))), nil
+}
+
+func (s *RAGService) mmrLambda(query types.RAGQuery) float64 {
+	if query.MMRLambda != nil {
+		return *query.MMRLambda
+	}
+	return s.config.MMRLambda
+}
+
+// candidateCount is how many reviews the first stage fetches: TopN when a
+// later stage can reorder or diversify them or has to balance several apps,
+// otherwise just TopK.
+func (s *RAGService) candidateCount(lambda float64, apps int) int {
+	diversifying := lambda > 0 && lambda < 1
+	if (s.reranker != nil || diversifying || apps > 1) && s.config.TopN > s.config.TopK {
+		return s.config.TopN
+	}
+	return s.config.TopK
+}
+
+func (s *RAGService) retrieveCandidates(ctx context.Context, query types.RAGQuery, queryEmbedding []float32, model string, limit int) ([]types.RetrievedReview, error) {
+	mode := query.Mode
+	if mode == "" {
+		mode = s.config.RetrievalMode
+	}
+
+	apps := query.Apps()
+	perApp := appQuota(limit, len(apps))
+
+	if mode != types.RetrievalModeHybrid {
+		return s.repo.RAGRetrieval(ctx, queryEmbedding, model, limit, perApp, apps, query.Filters)
+	}
+
+	var vectorResults, keywordResults []types.RetrievedReview
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		var err error
+		vectorResults, err = s.repo.RAGRetrieval(gctx, queryEmbedding, model, limit, perApp, apps, query.Filters)
+		return err
+	})
+
+	g.Go(func() error {
+		var err error
+		keywordResults, err = s.repo.KeywordRetrieval(gctx, queryEmbedding, model, query.Query, limit, perApp, apps, query.Filters)
+		return err
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return fuseRankings(s.config.RRFK, limit, vectorResults, keywordResults), nil
 }
 
 func (s *RAGService) buildEmptyResponse(query types.RAGQuery, startTime time.Time) *types.RAGResponse {
-	return &types.RAGResponse{
+	response := &types.RAGResponse{
 		Answer:           "No relevant reviews found for your query.",
+		Citations:        []types.Citation{},
 		RetrievedReviews: []types.RetrievedReview{},
 		Confidence:       0.0,
 		ProcessingTime:   time.Since(startTime).Seconds(),
 		QueryHash:        s.embedClient.GetQueryHash(query.Query),
 	}
-}
-
-func (s *RAGService) generateAnswer(query string, reviews []types.RetrievedReview) string {
-	if len(reviews) == 0 {
-		return "No relevant reviews found to answer your query."
+	if apps := query.Apps(); len(apps) > 1 {
+		response.Apps = appBreakdowns(apps, nil)
 	}
 
-	var positiveCount, negativeCount int
-	var avgRating float64
+	return response
+}
 
+// validateCitations drops review IDs that were not part of the retrieved set,
+// so the UI never links to a review the answer was not grounded in. The
+// dropped IDs are returned separately.
+func validateCitations(citations []types.Citation, reviews []types.RetrievedReview) ([]types.Citation, []string) {
+	retrieved := make(map[string]struct{}, len(reviews))
 	for _, review := range reviews {
-		if review.Rating >= 4 {
-			positiveCount++
-		} else if review.Rating <= 2 {
-			negativeCount++
-		}
-		avgRating += float64(review.Rating)
+		retrieved[review.ID] = struct{}{}
 	}
 
-	avgRating = avgRating / float64(len(reviews))
+	valid := make([]types.Citation, 0, len(citations))
+	var unverified []string
+	seen := make(map[string]struct{})
 
-	// Build answer based on sentiment and patterns
-	var answer strings.Builder
-	answer.WriteString(fmt.Sprintf("Based on %d relevant reviews, ", len(reviews)))
-
-	if positiveCount > negativeCount {
-		answer.WriteString("the overall sentiment is positive. ")
-	} else if negativeCount > positiveCount {
-		answer.WriteString("the overall sentiment is negative. ")
-	} else {
-		answer.WriteString("the sentiment is mixed. ")
-	}
+	for _, citation := range citations {
+		ids := make([]string, 0, len(citation.ReviewIDs))
+		for _, id := range citation.ReviewIDs {
+			if _, ok := retrieved[id]; ok {
+				ids = append(ids, id)
+				continue
+			}
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				unverified = append(unverified, id)
+			}
+		}
 
-	answer.WriteString(fmt.Sprintf("The average rating is %.1f/5. ", avgRating))
+		if len(ids) == 0 {
+			continue
+		}
 
-	answer.WriteString("Here are the most relevant reviews that address your query.")
+		citation.ReviewIDs = ids
+		valid = append(valid, citation)
+	}
 
-	return answer.String()
+	return valid, unverified
 }
 
 func (s *RAGService) calculateConfidence(reviews []types.RetrievedReview) float64 {
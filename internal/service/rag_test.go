@@ -2,12 +2,18 @@ package service
 
 import (
 	"context"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/generation"
 	"github.com/quiby-ai/review-rag/internal/storage"
 	"github.com/quiby-ai/review-rag/internal/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockEmbeddingClient struct {
@@ -19,6 +25,14 @@ func (m *MockEmbeddingClient) GenerateEmbedding(ctx context.Context, text string
 	return args.Get(0).([]float32), args.Error(1)
 }
 
+func (m *MockEmbeddingClient) GenerateEmbeddings(ctx context.Context, texts []string) (*embedding.Batch, error) {
+	args := m.Called(ctx, texts)
+	if batch, ok := args.Get(0).(*embedding.Batch); ok {
+		return batch, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockEmbeddingClient) GetQueryHash(text string) string {
 	args := m.Called(text)
 	return args.String(0)
@@ -38,21 +52,111 @@ func (m *MockRepository) GetReviewDetails(ctx context.Context, reviewIDs []strin
 	return args.Get(0).(map[string]storage.ReviewDetails), args.Error(1)
 }
 
-func (m *MockRepository) RAGRetrieval(ctx context.Context, queryEmbedding []float32, topK int, appID string) ([]types.RetrievedReview, error) {
-	args := m.Called(ctx, queryEmbedding, topK, appID)
+func (m *MockRepository) RAGRetrieval(ctx context.Context, queryEmbedding []float32, model string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error) {
+	args := m.Called(ctx, queryEmbedding, model, topK, perApp, appIDs, filters)
 	return args.Get(0).([]types.RetrievedReview), args.Error(1)
 }
 
-func (m *MockRepository) InitRAGTables(ctx context.Context) error {
+func (m *MockRepository) KeywordRetrieval(ctx context.Context, queryEmbedding []float32, model string, queryText string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error) {
+	args := m.Called(ctx, queryEmbedding, model, queryText, topK, perApp, appIDs, filters)
+	return args.Get(0).([]types.RetrievedReview), args.Error(1)
+}
+
+func (m *MockRepository) GetCachedEmbeddings(ctx context.Context, textHashes []string, model string) (map[string][]float32, error) {
+	args := m.Called(ctx, textHashes, model)
+	return args.Get(0).(map[string][]float32), args.Error(1)
+}
+
+func (m *MockRepository) StoreCachedEmbedding(ctx context.Context, textHash, text, model string, embedding []float32, expiresAt time.Time) error {
+	args := m.Called(ctx, textHash, text, model, embedding, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CleanupExpiredEmbeddings(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
 
+func (m *MockRepository) LogQuery(ctx context.Context, entry storage.QueryLogEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RecordMetrics(ctx context.Context, metrics []types.Metric) error {
+	args := m.Called(ctx, metrics)
+	return args.Error(0)
+}
+
 func (m *MockRepository) HealthCheck(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
 
+func (m *MockRepository) MissingSchemaObjects(ctx context.Context, tables []string) ([]string, error) {
+	args := m.Called(ctx, tables)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) VectorDimensions(ctx context.Context, table, column string) (int, error) {
+	args := m.Called(ctx, table, column)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) GetEmbeddingModel(ctx context.Context, table string) (string, int, bool, error) {
+	args := m.Called(ctx, table)
+	return args.String(0), args.Int(1), args.Bool(2), args.Error(3)
+}
+
+func (m *MockRepository) RecordEmbeddingModel(ctx context.Context, table, model string, dimensions int) error {
+	args := m.Called(ctx, table, model, dimensions)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PendingReviews(ctx context.Context, model, appID, afterID string, limit int) ([]storage.PendingReview, error) {
+	args := m.Called(ctx, model, appID, afterID, limit)
+	return args.Get(0).([]storage.PendingReview), args.Error(1)
+}
+
+func (m *MockRepository) UpsertReviewEmbeddings(ctx context.Context, model string, embeddings []storage.ReviewEmbedding) error {
+	args := m.Called(ctx, model, embeddings)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ShadowCoverage(ctx context.Context, model string) ([]types.AppEmbeddingCoverage, error) {
+	args := m.Called(ctx, model)
+	return args.Get(0).([]types.AppEmbeddingCoverage), args.Error(1)
+}
+
+func (m *MockRepository) PromoteShadowEmbeddings(ctx context.Context, model string) (int, error) {
+	args := m.Called(ctx, model)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) GetIndexCheckpoint(ctx context.Context, name string) (string, error) {
+	args := m.Called(ctx, name)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) SaveIndexCheckpoint(ctx context.Context, name, lastReviewID string) error {
+	args := m.Called(ctx, name, lastReviewID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) AppReviewEmbeddings(ctx context.Context, appID string, since time.Time, limit int) ([]types.RetrievedReview, error) {
+	args := m.Called(ctx, appID, since, limit)
+	return args.Get(0).([]types.RetrievedReview), args.Error(1)
+}
+
+func (m *MockRepository) SimilarityTrend(ctx context.Context, queryEmbedding []float32, model, appID, interval string, maxDistance float64, filters *types.RAGFilters) ([]types.TrendBucket, error) {
+	args := m.Called(ctx, queryEmbedding, model, appID, interval, maxDistance, filters)
+	return args.Get(0).([]types.TrendBucket), args.Error(1)
+}
+
+func (m *MockRepository) VersionTopicStats(ctx context.Context, queryEmbedding []float32, model, appID string, versions []string, maxDistance float64) ([]types.VersionTopicStats, error) {
+	args := m.Called(ctx, queryEmbedding, model, appID, versions, maxDistance)
+	return args.Get(0).([]types.VersionTopicStats), args.Error(1)
+}
+
 func (m *MockRepository) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -63,7 +167,7 @@ func TestRAGService_Query_Success(t *testing.T) {
 	mockEmbed := &MockEmbeddingClient{}
 	mockRepo := &MockRepository{}
 
-	service := NewRAGService(mockEmbed, mockRepo, RAGConfig{
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
 		TopN:          20,
 		TopK:          5,
 		ANNProbes:     10,
@@ -83,7 +187,7 @@ func TestRAGService_Query_Success(t *testing.T) {
 		{ID: "review-1", Similarity: 0.9, Country: "US", Rating: 5},
 		{ID: "review-2", Similarity: 0.8, Country: "US", Rating: 4},
 	}
-	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, 5, query.AppID).Return(expectedReviews, nil)
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return(expectedReviews, nil)
 
 	ctx := context.Background()
 	response, err := service.Query(ctx, query)
@@ -93,6 +197,10 @@ func TestRAGService_Query_Success(t *testing.T) {
 	assert.Equal(t, "test-hash-123", response.QueryHash)
 	assert.Len(t, response.RetrievedReviews, 2)
 	assert.True(t, response.ProcessingTime >= 0)
+	assert.NotContains(t, response.Answer, "[review-1")
+	assert.Len(t, response.Citations, 1)
+	assert.Equal(t, []string{"review-1", "review-2"}, response.Citations[0].ReviewIDs)
+	assert.Empty(t, response.UnverifiedCitations)
 
 	mockEmbed.AssertExpectations(t)
 	mockRepo.AssertExpectations(t)
@@ -103,7 +211,7 @@ func TestRAGService_Query_NoResults(t *testing.T) {
 	mockEmbed := &MockEmbeddingClient{}
 	mockRepo := &MockRepository{}
 
-	service := NewRAGService(mockEmbed, mockRepo, RAGConfig{
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
 		TopN:          20,
 		TopK:          5,
 		ANNProbes:     10,
@@ -119,7 +227,7 @@ func TestRAGService_Query_NoResults(t *testing.T) {
 	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
 	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
 
-	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, 5, query.AppID).Return([]types.RetrievedReview{}, nil)
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return([]types.RetrievedReview{}, nil)
 
 	ctx := context.Background()
 	response, err := service.Query(ctx, query)
@@ -140,7 +248,7 @@ func TestRAGService_Query_EmbeddingError(t *testing.T) {
 	mockEmbed := &MockEmbeddingClient{}
 	mockRepo := &MockRepository{}
 
-	service := NewRAGService(mockEmbed, mockRepo, RAGConfig{
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
 		TopN:          20,
 		TopK:          5,
 		ANNProbes:     10,
@@ -169,7 +277,7 @@ func TestRAGService_Query_SearchError(t *testing.T) {
 	mockEmbed := &MockEmbeddingClient{}
 	mockRepo := &MockRepository{}
 
-	service := NewRAGService(mockEmbed, mockRepo, RAGConfig{
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
 		TopN:          20,
 		TopK:          5,
 		ANNProbes:     10,
@@ -184,7 +292,7 @@ func TestRAGService_Query_SearchError(t *testing.T) {
 	expectedEmbedding := []float32{0.1, 0.2, 0.3}
 	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
 
-	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, 5, query.AppID).Return([]types.RetrievedReview(nil), assert.AnError)
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return([]types.RetrievedReview(nil), assert.AnError)
 
 	ctx := context.Background()
 	response, err := service.Query(ctx, query)
@@ -196,3 +304,758 @@ func TestRAGService_Query_SearchError(t *testing.T) {
 	mockEmbed.AssertExpectations(t)
 	mockRepo.AssertExpectations(t)
 }
+
+type MockGenerator struct {
+	mock.Mock
+}
+
+func (m *MockGenerator) Generate(ctx context.Context, query string, reviews []types.RetrievedReview) (string, error) {
+	args := m.Called(ctx, query, reviews)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockGenerator) GenerateStream(ctx context.Context, query string, reviews []types.RetrievedReview, onToken func(string) error) (string, error) {
+	args := m.Called(ctx, query, reviews, onToken)
+	return args.String(0), args.Error(1)
+}
+
+func TestRAGService_Query_GenerationError(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	mockGenerator := &MockGenerator{}
+
+	service := NewRAGService(mockEmbed, mockRepo, mockGenerator, RAGConfig{
+		TopN:          20,
+		TopK:          5,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	})
+
+	query := types.RAGQuery{
+		Query: "What do users think about the app?",
+		AppID: "com.test.app",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+
+	expectedReviews := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9, Country: "US", Rating: 5},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return(expectedReviews, nil)
+	mockGenerator.On("Generate", mock.Anything, query.Query, expectedReviews).Return("", assert.AnError)
+
+	ctx := context.Background()
+	response, err := service.Query(ctx, query)
+
+	assert.Error(t, err)
+	assert.Nil(t, response)
+	assert.Contains(t, err.Error(), "failed to generate answer")
+
+	mockEmbed.AssertExpectations(t)
+	mockRepo.AssertExpectations(t)
+	mockGenerator.AssertExpectations(t)
+}
+
+func TestValidateCitations_DropsHallucinatedIDs(t *testing.T) {
+	reviews := []types.RetrievedReview{
+		{ID: "review-1"},
+		{ID: "review-2"},
+	}
+	citations := []types.Citation{
+		{Start: 0, End: 10, ReviewIDs: []string{"review-1", "review-9"}},
+		{Start: 11, End: 20, ReviewIDs: []string{"review-7"}},
+		{Start: 21, End: 30, ReviewIDs: []string{"review-2"}},
+	}
+
+	valid, unverified := validateCitations(citations, reviews)
+
+	assert.Len(t, valid, 2)
+	assert.Equal(t, []string{"review-1"}, valid[0].ReviewIDs)
+	assert.Equal(t, []string{"review-2"}, valid[1].ReviewIDs)
+	assert.Equal(t, []string{"review-9", "review-7"}, unverified)
+}
+
+func TestRAGService_QueryStream(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          20,
+		TopK:          5,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	})
+
+	query := types.RAGQuery{
+		Query: "What do users think about the app?",
+		AppID: "com.test.app",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	expectedReviews := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9, Country: "US", Rating: 5},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{query.AppID}, query.Filters).Return(expectedReviews, nil)
+
+	var events []string
+	var streamed strings.Builder
+	response, err := service.QueryStream(context.Background(), query, StreamObserver{
+		OnReviews: func(reviews []types.RetrievedReview) error {
+			events = append(events, "reviews")
+			assert.Equal(t, expectedReviews, reviews)
+			return nil
+		},
+		OnToken: func(token string) error {
+			if len(events) == 0 || events[len(events)-1] != "token" {
+				events = append(events, "token")
+			}
+			streamed.WriteString(token)
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"reviews", "token"}, events)
+	assert.Contains(t, streamed.String(), response.Answer)
+	assert.Equal(t, "test-hash-123", response.QueryHash)
+
+	mockEmbed.AssertExpectations(t)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Query_HybridMode(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          20,
+		TopK:          3,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+		RetrievalMode: types.RetrievalModeVector,
+	})
+
+	query := types.RAGQuery{
+		Query: "error E1234 after update",
+		AppID: "com.test.app",
+		Mode:  types.RetrievalModeHybrid,
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	vectorReviews := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9},
+		{ID: "review-2", Similarity: 0.8},
+		{ID: "review-3", Similarity: 0.7},
+	}
+	keywordReviews := []types.RetrievedReview{
+		{ID: "review-4", Similarity: 0.5},
+		{ID: "review-2", Similarity: 0.8},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 3, 0, []string{query.AppID}, query.Filters).Return(vectorReviews, nil)
+	mockRepo.On("KeywordRetrieval", mock.Anything, expectedEmbedding, "", query.Query, 3, 0, []string{query.AppID}, query.Filters).Return(keywordReviews, nil)
+
+	response, err := service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	ids := make([]string, 0, len(response.RetrievedReviews))
+	for _, review := range response.RetrievedReviews {
+		ids = append(ids, review.ID)
+	}
+	assert.Equal(t, []string{"review-2", "review-1", "review-4"}, ids)
+
+	mockEmbed.AssertExpectations(t)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFuseRankings(t *testing.T) {
+	a := []types.RetrievedReview{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	b := []types.RetrievedReview{{ID: "c"}, {ID: "d"}}
+
+	fused := fuseRankings(60, 0, a, b)
+
+	ids := make([]string, 0, len(fused))
+	for _, review := range fused {
+		ids = append(ids, review.ID)
+	}
+	// c: 1/63 + 1/61, a: 1/61, d: 1/62, b: 1/62 (b seen first)
+	assert.Equal(t, []string{"c", "a", "b", "d"}, ids)
+	assert.Len(t, fuseRankings(60, 2, a, b), 2)
+}
+
+type MockReranker struct {
+	mock.Mock
+}
+
+func (m *MockReranker) Rerank(ctx context.Context, query string, reviews []types.RetrievedReview) ([]types.RetrievedReview, error) {
+	args := m.Called(ctx, query, reviews)
+	return args.Get(0).([]types.RetrievedReview), args.Error(1)
+}
+
+func TestRAGService_Query_RerankTopNToTopK(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	mockReranker := &MockReranker{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          4,
+		TopK:          2,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	}, WithReranker(mockReranker))
+
+	query := types.RAGQuery{
+		Query: "What do users think about the app?",
+		AppID: "com.test.app",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	candidates := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9},
+		{ID: "review-2", Similarity: 0.85},
+		{ID: "review-3", Similarity: 0.8},
+		{ID: "review-4", Similarity: 0.75},
+	}
+	reranked := []types.RetrievedReview{candidates[3], candidates[1], candidates[0], candidates[2]}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 4, 0, []string{query.AppID}, query.Filters).Return(candidates, nil)
+	mockReranker.On("Rerank", mock.Anything, query.Query, candidates).Return(reranked, nil)
+
+	response, err := service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []types.RetrievedReview{candidates[3], candidates[1]}, response.RetrievedReviews)
+
+	mockEmbed.AssertExpectations(t)
+	mockRepo.AssertExpectations(t)
+	mockReranker.AssertExpectations(t)
+}
+
+func TestRAGService_Query_RerankFailureKeepsRetrievalOrder(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	mockReranker := &MockReranker{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          3,
+		TopK:          2,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	}, WithReranker(mockReranker))
+
+	query := types.RAGQuery{
+		Query: "What do users think about the app?",
+		AppID: "com.test.app",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	candidates := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9},
+		{ID: "review-2", Similarity: 0.85},
+		{ID: "review-3", Similarity: 0.8},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 3, 0, []string{query.AppID}, query.Filters).Return(candidates, nil)
+	mockReranker.On("Rerank", mock.Anything, query.Query, candidates).Return([]types.RetrievedReview(nil), assert.AnError)
+
+	response, err := service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, candidates[:2], response.RetrievedReviews)
+}
+
+func TestDiversify_SkipsNearDuplicates(t *testing.T) {
+	candidates := []types.RetrievedReview{
+		{ID: "crash-1", Similarity: 0.95, Embedding: []float32{1, 0, 0}},
+		{ID: "crash-2", Similarity: 0.94, Embedding: []float32{0.99, 0.01, 0}},
+		{ID: "crash-3", Similarity: 0.93, Embedding: []float32{0.98, 0.02, 0}},
+		{ID: "battery", Similarity: 0.80, Embedding: []float32{0, 1, 0}},
+		{ID: "pricing", Similarity: 0.75, Embedding: []float32{0, 0, 1}},
+	}
+
+	ids := func(reviews []types.RetrievedReview) []string {
+		result := make([]string, len(reviews))
+		for i, review := range reviews {
+			result[i] = review.ID
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"crash-1", "battery", "pricing"}, ids(diversify(candidates, 3, 0, 0.5, false)))
+	assert.Equal(t, []string{"crash-1", "crash-2", "crash-3"}, ids(diversify(candidates, 3, 0, 0.99, false)))
+	assert.Len(t, diversify(candidates[:2], 3, 0, 0.5, false), 2)
+}
+
+func TestApplyAppQuota(t *testing.T) {
+	ranked := []types.RetrievedReview{
+		{ID: "a-1", AppID: "a"},
+		{ID: "a-2", AppID: "a"},
+		{ID: "a-3", AppID: "a"},
+		{ID: "b-1", AppID: "b"},
+		{ID: "a-4", AppID: "a"},
+	}
+
+	ids := func(reviews []types.RetrievedReview) []string {
+		result := make([]string, len(reviews))
+		for i, review := range reviews {
+			result[i] = review.ID
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"a-1", "a-2", "b-1"}, ids(applyAppQuota(ranked, 3, 2)))
+	// b runs short, so its unused slot goes back to a.
+	assert.Equal(t, []string{"a-1", "a-2", "a-3", "b-1"}, ids(applyAppQuota(ranked, 4, 2)))
+	assert.Equal(t, []string{"a-1", "a-2", "a-3"}, ids(applyAppQuota(ranked, 3, 0)))
+	assert.Equal(t, 3, appQuota(5, 2))
+	assert.Equal(t, 0, appQuota(5, 1))
+}
+
+func TestRAGService_Query_MultipleApps(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          6,
+		TopK:          3,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	})
+
+	query := types.RAGQuery{
+		Query:  "How stable is the app?",
+		AppIDs: []string{"com.big.app", "com.small.app", "com.quiet.app"},
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	candidates := []types.RetrievedReview{
+		{ID: "big-1", AppID: "com.big.app", Rating: 1, Similarity: 0.95},
+		{ID: "big-2", AppID: "com.big.app", Rating: 2, Similarity: 0.94},
+		{ID: "big-3", AppID: "com.big.app", Rating: 1, Similarity: 0.93},
+		{ID: "small-1", AppID: "com.small.app", Rating: 4, Similarity: 0.8},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 6, 2, query.AppIDs, query.Filters).Return(candidates, nil)
+
+	response, err := service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []types.RetrievedReview{candidates[0], candidates[1], candidates[3]}, response.RetrievedReviews)
+	assert.Equal(t, []types.AppBreakdown{
+		{AppID: "com.big.app", ReviewCount: 2, AverageRating: 1.5, TopReviewIDs: []string{"big-1", "big-2"}},
+		{AppID: "com.small.app", ReviewCount: 1, AverageRating: 4, TopReviewIDs: []string{"small-1"}},
+		{AppID: "com.quiet.app", TopReviewIDs: []string{}},
+	}, response.Apps)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Query_MMRLambdaPerRequest(t *testing.T) {
+
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:          4,
+		TopK:          2,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	})
+
+	lambda := 0.5
+	query := types.RAGQuery{
+		Query:     "What do users think about the app?",
+		AppID:     "com.test.app",
+		MMRLambda: &lambda,
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+
+	candidates := []types.RetrievedReview{
+		{ID: "review-1", Similarity: 0.9, Embedding: []float32{1, 0}},
+		{ID: "review-2", Similarity: 0.89, Embedding: []float32{1, 0.01}},
+		{ID: "review-3", Similarity: 0.8, Embedding: []float32{0, 1}},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 4, 0, []string{query.AppID}, query.Filters).Return(candidates, nil)
+
+	response, err := service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []types.RetrievedReview{candidates[0], candidates[2]}, response.RetrievedReviews)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_QueryBatch_SharesEmbeddingCall(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:             10,
+		TopK:             5,
+		ANNProbes:        10,
+		MinConfidence:    0.7,
+		BatchConcurrency: 2,
+	})
+
+	queries := []types.RAGQuery{
+		{Query: "crashes", AppID: "com.test.app"},
+		{Query: "pricing", AppID: "com.test.app"},
+		{Query: "crashes", AppID: "com.other.app"},
+	}
+
+	crashEmbedding := []float32{0.1, 0.2}
+	pricingEmbedding := []float32{0.3, 0.4}
+	mockEmbed.On("GenerateEmbeddings", mock.Anything, []string{"crashes", "pricing"}).Return(&embedding.Batch{
+		Embeddings: [][]float32{crashEmbedding, pricingEmbedding},
+	}, nil).Once()
+	mockEmbed.On("GetQueryHash", mock.Anything).Return("test-hash-123")
+
+	reviews := []types.RetrievedReview{
+		{ID: "review-1", Content: "Crashes on launch", Rating: 1, Similarity: 0.9},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, crashEmbedding, "", 5, 0, []string{"com.test.app"}, (*types.RAGFilters)(nil)).Return(reviews, nil)
+	mockRepo.On("RAGRetrieval", mock.Anything, pricingEmbedding, "", 5, 0, []string{"com.test.app"}, (*types.RAGFilters)(nil)).Return([]types.RetrievedReview{}, assert.AnError)
+	mockRepo.On("RAGRetrieval", mock.Anything, crashEmbedding, "", 5, 0, []string{"com.other.app"}, (*types.RAGFilters)(nil)).Return([]types.RetrievedReview{}, nil)
+
+	items, err := service.QueryBatch(context.Background(), queries, false)
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.NotNil(t, items[0].Response)
+	assert.Equal(t, "review-1", items[0].Response.RetrievedReviews[0].ID)
+	assert.Nil(t, items[1].Response)
+	assert.Contains(t, items[1].Error, "failed to retrieve")
+	assert.NotNil(t, items[2].Response)
+	assert.Empty(t, items[2].Error)
+	assert.Equal(t, 2, items[2].Index)
+
+	mockEmbed.AssertExpectations(t)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_QueryBatch_RetrievalOnly(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	mockGenerator := &MockGenerator{}
+
+	service := NewRAGService(mockEmbed, mockRepo, mockGenerator, RAGConfig{
+		TopN:             10,
+		TopK:             5,
+		ANNProbes:        10,
+		MinConfidence:    0.7,
+		BatchItemTimeout: time.Second,
+	})
+
+	queries := []types.RAGQuery{{Query: "crashes", AppID: "com.test.app"}}
+
+	crashEmbedding := []float32{0.1, 0.2}
+	mockEmbed.On("GenerateEmbeddings", mock.Anything, []string{"crashes"}).Return(&embedding.Batch{
+		Embeddings: [][]float32{crashEmbedding},
+	}, nil).Once()
+	mockEmbed.On("GetQueryHash", mock.Anything).Return("test-hash-123")
+
+	reviews := []types.RetrievedReview{
+		{ID: "review-1", Content: "Crashes on launch", Rating: 1, Similarity: 0.9},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, crashEmbedding, "", 5, 0, []string{"com.test.app"}, (*types.RAGFilters)(nil)).Return(reviews, nil)
+
+	items, err := service.QueryBatch(context.Background(), queries, true)
+
+	assert.NoError(t, err)
+	assert.Empty(t, items[0].Error)
+	assert.Empty(t, items[0].Response.Answer)
+	assert.Equal(t, reviews, items[0].Response.RetrievedReviews)
+
+	mockGenerator.AssertNotCalled(t, "Generate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRAGService_ShadowSwitchAtFullCoverage(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockShadowEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:           10,
+		TopK:           5,
+		ANNProbes:      10,
+		MinConfidence:  0.7,
+		SwitchToShadow: true,
+	}, WithShadowEmbeddings(mockShadowEmbed, "large"))
+
+	mockRepo.On("ShadowCoverage", mock.Anything, "large").Return([]types.AppEmbeddingCoverage{
+		{AppID: "com.a", Total: 2, Embedded: 2},
+		{AppID: "com.b", Total: 2, Embedded: 1},
+	}, nil).Twice()
+
+	status, err := service.EmbeddingMigrationStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, status.Coverage)
+	assert.Equal(t, 0.5, status.Apps[1].Coverage)
+	assert.False(t, status.Active)
+
+	assert.False(t, service.trySwitchToShadow(context.Background()))
+
+	mockRepo.On("ShadowCoverage", mock.Anything, "large").Return([]types.AppEmbeddingCoverage{
+		{AppID: "com.a", Total: 2, Embedded: 2},
+		{AppID: "com.b", Total: 2, Embedded: 2},
+	}, nil)
+
+	assert.True(t, service.trySwitchToShadow(context.Background()))
+
+	query := types.RAGQuery{Query: "crashes", AppID: "com.a"}
+	shadowEmbedding := []float32{0.4, 0.5, 0.6}
+	mockShadowEmbed.On("GenerateEmbedding", mock.Anything, query.Query).Return(shadowEmbedding, nil)
+	mockEmbed.On("GetQueryHash", query.Query).Return("test-hash-123")
+	mockRepo.On("RAGRetrieval", mock.Anything, shadowEmbedding, "large", 5, 0, []string{query.AppID}, query.Filters).Return([]types.RetrievedReview{}, nil)
+
+	_, err = service.Query(context.Background(), query)
+
+	assert.NoError(t, err)
+	mockEmbed.AssertNotCalled(t, "GenerateEmbedding", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Compare(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+	mockGenerator := &MockGenerator{}
+
+	service := NewRAGService(mockEmbed, mockRepo, mockGenerator, RAGConfig{
+		TopN:          10,
+		TopK:          5,
+		ANNProbes:     10,
+		MinConfidence: 0.7,
+	})
+
+	request := types.CompareRequest{
+		Query:  "How do users feel about onboarding?",
+		AppIDs: []string{"com.ours", "com.theirs"},
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, request.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", request.Query).Return("test-hash-123")
+
+	ours := []types.RetrievedReview{
+		{ID: "ours-1", AppID: "com.ours", Content: "The onboarding tutorial is far too long", Rating: 2, Similarity: 0.9},
+		{ID: "ours-2", AppID: "com.ours", Content: "Skipped the tutorial, onboarding was painful", Rating: 1, Similarity: 0.85},
+	}
+	theirs := []types.RetrievedReview{
+		{ID: "theirs-1", AppID: "com.theirs", Content: "Signup asks for a phone number", Rating: 4, Similarity: 0.8},
+		{ID: "theirs-2", AppID: "com.theirs", Content: "Quick signup, though the phone number step is odd", Rating: 5, Similarity: 0.75},
+		{ID: "theirs-3", AppID: "com.theirs", Content: "Fine onboarding", Rating: 3, Similarity: 0.7},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{"com.ours"}, (*types.RAGFilters)(nil)).Return(ours, nil)
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{"com.theirs"}, (*types.RAGFilters)(nil)).Return(theirs, nil)
+
+	question := comparisonQuestion(request.Query, request.AppIDs)
+	mockGenerator.On("Generate", mock.Anything, question, append(append([]types.RetrievedReview{}, ours...), theirs...)).
+		Return("Users of com.ours find onboarding long [ours-1]. Users of com.theirs mind the phone step [theirs-1, missing].", nil)
+
+	response, err := service.Compare(context.Background(), request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ours-1", "theirs-1"}, append(response.Citations[0].ReviewIDs, response.Citations[1].ReviewIDs...))
+	assert.Equal(t, []string{"missing"}, response.UnverifiedCitations)
+
+	assert.Len(t, response.Apps, 2)
+	assert.Equal(t, "com.ours", response.Apps[0].AppID)
+	assert.Equal(t, 1.5, response.Apps[0].AverageRating)
+	assert.Equal(t, "negative", response.Apps[0].Sentiment)
+	assert.Equal(t, []string{"tutorial", "onboarding"}, response.Apps[0].DistinctThemes)
+	assert.Equal(t, 4.0, response.Apps[1].AverageRating)
+	assert.Equal(t, "positive", response.Apps[1].Sentiment)
+	assert.InDelta(t, 2.0/3, response.Apps[1].PositiveShare, 1e-9)
+	assert.Equal(t, []string{"number", "phone", "signup"}, response.Apps[1].DistinctThemes)
+	assert.Len(t, response.Apps[1].RepresentativeReviews, 3)
+
+	mockRepo.AssertExpectations(t)
+	mockGenerator.AssertExpectations(t)
+}
+
+func TestRAGService_Themes(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:            10,
+		TopK:            5,
+		ThemeSampleSize: 100,
+	})
+
+	jan := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC)
+	reviews := []types.RetrievedReview{
+		{ID: "crash-1", Content: "Crashes on launch", Rating: 1, Date: feb, Embedding: []float32{1, 0.1}},
+		{ID: "price-1", Content: "Subscription price too high", Rating: 2, Date: feb, Embedding: []float32{0.1, 1}},
+		{ID: "crash-2", Content: "Crashes every launch since update", Rating: 1, Date: feb, Embedding: []float32{1, 0}},
+		{ID: "crash-3", Content: "App crashes when I open it", Rating: 2, Date: jan, Embedding: []float32{0.9, 0.1}},
+		{ID: "price-2", Content: "Subscription price doubled", Rating: 3, Date: jan, Embedding: []float32{0, 1}},
+	}
+	mockRepo.On("AppReviewEmbeddings", mock.Anything, "com.test.app", time.Time{}, 100).Return(reviews, nil)
+
+	response, err := service.Themes(context.Background(), types.ThemesQuery{AppID: "com.test.app", K: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, response.ReviewCount)
+	assert.Len(t, response.Themes, 2)
+
+	crashes := response.Themes[0]
+	assert.Equal(t, 3, crashes.Size)
+	assert.Equal(t, "crashes, launch", crashes.Label)
+	assert.InDelta(t, 4.0/3, crashes.AverageRating, 1e-9)
+	assert.Equal(t, "crash-1", crashes.RepresentativeReviews[0].ID)
+	assert.Equal(t, []types.ThemePeriod{
+		{Month: "2026-01", Count: 1, Share: 0.5},
+		{Month: "2026-02", Count: 2, Share: 2.0 / 3},
+	}, crashes.Trend)
+
+	assert.Equal(t, []string{"price", "subscription"}, response.Themes[1].Keywords)
+	assert.Equal(t, 0.4, response.Themes[1].Share)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Trend(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN:               10,
+		TopK:               5,
+		TrendMinSimilarity: 0.6,
+	})
+
+	week := func(n int) time.Time {
+		return time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 7*n)
+	}
+	filters := &types.RAGFilters{From: week(-1).AddDate(0, 0, 3), To: week(8)}
+	request := types.TrendRequest{Query: "battery drain", AppID: "com.test.app", Filters: filters}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, request.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", request.Query).Return("test-hash-123")
+
+	buckets := []types.TrendBucket{
+		{Start: week(0), Matching: 2, Total: 20, AverageRating: 2},
+		{Start: week(1), Matching: 1, Total: 18, AverageRating: 1},
+		{Start: week(3), Matching: 2, Total: 25, AverageRating: 2.5},
+		{Start: week(4), Matching: 1, Total: 22, AverageRating: 2},
+		{Start: week(5), Matching: 9, Total: 30, AverageRating: 1.5},
+	}
+	mockRepo.On("SimilarityTrend", mock.Anything, expectedEmbedding, "", "com.test.app", "week", mock.MatchedBy(func(d float64) bool {
+		return math.Abs(d-0.4) < 1e-9
+	}), filters).Return(buckets, nil)
+
+	response, err := service.Trend(context.Background(), request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "week", response.Interval)
+	require.Len(t, response.Buckets, 9)
+	assert.Equal(t, types.TrendBucket{Start: week(-1)}, response.Buckets[0], "the window is padded at its start")
+	assert.Equal(t, types.TrendBucket{Start: week(2)}, response.Buckets[3], "missing weeks are filled with zeros")
+	assert.Equal(t, week(7), response.Buckets[8].Start, "the window is padded at its end")
+	assert.Zero(t, response.Buckets[8].Total)
+	assert.Equal(t, 0.3, response.Buckets[6].Share)
+	assert.True(t, response.Buckets[6].Anomaly)
+	assert.InDelta(t, 8, response.Buckets[6].ZScore, 1e-9)
+	for i, bucket := range response.Buckets {
+		assert.Equal(t, i == 6, bucket.Anomaly)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRAGService_Regression(t *testing.T) {
+	mockEmbed := &MockEmbeddingClient{}
+	mockRepo := &MockRepository{}
+
+	service := NewRAGService(mockEmbed, mockRepo, generation.NewTemplateGenerator(), RAGConfig{
+		TopN: 10,
+		TopK: 5,
+	})
+
+	request := types.RegressionRequest{
+		Query:         "battery drain",
+		AppID:         "com.test.app",
+		BaseVersion:   "5.1.0",
+		TargetVersion: "5.2.0",
+	}
+
+	expectedEmbedding := []float32{0.1, 0.2, 0.3}
+	mockEmbed.On("GenerateEmbedding", mock.Anything, request.Query).Return(expectedEmbedding, nil)
+	mockEmbed.On("GetQueryHash", request.Query).Return("test-hash-123")
+
+	mockRepo.On("VersionTopicStats", mock.Anything, expectedEmbedding, "", "com.test.app", []string{"5.1.0", "5.2.0"}, 0.5).Return([]types.VersionTopicStats{
+		{Version: "5.1.0", Matching: 5, Total: 200},
+		{Version: "5.2.0", Matching: 30, Total: 200},
+	}, nil)
+	reviews := []types.RetrievedReview{
+		{ID: "drain-1", AppVersion: "5.2.0", Similarity: 0.8},
+		{ID: "unrelated", AppVersion: "5.2.0", Similarity: 0.3},
+	}
+	mockRepo.On("RAGRetrieval", mock.Anything, expectedEmbedding, "", 5, 0, []string{"com.test.app"}, &types.RAGFilters{Versions: []string{"5.2.0"}}).Return(reviews, nil)
+
+	response, err := service.Regression(context.Background(), request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0.025, response.Base.Share)
+	assert.Equal(t, 0.15, response.Target.Share)
+	assert.InDelta(t, 0.125, response.ShareChange, 1e-9)
+	assert.Greater(t, response.ZScore, regressionZ)
+	assert.True(t, response.Regression)
+	assert.Equal(t, reviews[:1], response.Reviews)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVersionBreakdowns(t *testing.T) {
+	reviews := []types.RetrievedReview{
+		{ID: "a", AppVersion: "5.2.0", Rating: 1},
+		{ID: "b", Rating: 4},
+		{ID: "c", AppVersion: "5.2.0", Rating: 2},
+	}
+
+	assert.Equal(t, []types.VersionBreakdown{
+		{Version: "5.2.0", ReviewCount: 2, AverageRating: 1.5, TopReviewIDs: []string{"a", "c"}},
+		{Version: "unknown", ReviewCount: 1, AverageRating: 4, TopReviewIDs: []string{"b"}},
+	}, versionBreakdowns(reviews))
+}
+
+func TestTrendWindow(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+
+	first, last := trendWindow(trendFilters(nil), "week", now)
+	assert.Equal(t, time.Date(2026, 4, 13, 0, 0, 0, 0, time.UTC), first, "180 days back, on a Monday")
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), last)
+
+	first, last = trendWindow(&types.RAGFilters{
+		From: time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+	}, "month", now)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), first)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), last, "To is exclusive")
+
+	filled := fillTrendGaps(nil, "month", first, last)
+	assert.Len(t, filled, 3, "a window without reviews is all zeros")
+}
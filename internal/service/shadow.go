@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/embedding"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// shadowEmbeddings is the model being migrated to. Once active, queries are
+// embedded with its client and searched against its shadow vectors.
+type shadowEmbeddings struct {
+	client embedding.Client
+	model  string
+	active atomic.Bool
+}
+
+// WithShadowEmbeddings registers model, embedded by client, as the target of
+// an embedding migration. Retrieval moves over only when
+// RAGConfig.SwitchToShadow is set and RunShadowSwitch sees full coverage.
+func WithShadowEmbeddings(client embedding.Client, model string) Option {
+	return func(s *RAGService) {
+		s.shadow = &shadowEmbeddings{client: client, model: model}
+	}
+}
+
+// embeddingTarget returns the client to embed a query with and the model to
+// pass to retrieval. Both must be taken together so a switch during a query
+// cannot mix them.
+func (s *RAGService) embeddingTarget() (embedding.Client, string) {
+	if s.shadow != nil && s.shadow.active.Load() {
+		return s.shadow.client, s.shadow.model
+	}
+	return s.embedClient, ""
+}
+
+// EmbeddingMigrationStatus reports backfill progress of the shadow model per
+// app. It returns nil when no migration is configured.
+func (s *RAGService) EmbeddingMigrationStatus(ctx context.Context) (*types.EmbeddingMigrationStatus, error) {
+	if s.shadow == nil {
+		return nil, nil
+	}
+
+	apps, err := s.repo.ShadowCoverage(ctx, s.shadow.model)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &types.EmbeddingMigrationStatus{
+		Model:  s.shadow.model,
+		Active: s.shadow.active.Load(),
+		Apps:   apps,
+	}
+	for i := range status.Apps {
+		app := &status.Apps[i]
+		app.Coverage = coverage(app.Embedded, app.Total)
+		status.Total += app.Total
+		status.Embedded += app.Embedded
+	}
+	status.Coverage = coverage(status.Embedded, status.Total)
+
+	if status.Apps == nil {
+		status.Apps = []types.AppEmbeddingCoverage{}
+	}
+
+	return status, nil
+}
+
+// RunShadowSwitch checks the backfill every interval and moves retrieval to
+// the shadow embeddings once every review has one. The switch is one-way
+// for the life of the process.
+func (s *RAGService) RunShadowSwitch(ctx context.Context, interval time.Duration) {
+	if s.shadow == nil || !s.config.SwitchToShadow {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.trySwitchToShadow(ctx) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RAGService) trySwitchToShadow(ctx context.Context) bool {
+	status, err := s.EmbeddingMigrationStatus(ctx)
+	if err != nil {
+		log.Printf("Failed to check shadow embedding coverage: %v", err)
+		return false
+	}
+
+	if status.Total == 0 || status.Embedded < status.Total {
+		log.Printf("Shadow embeddings for %s cover %d of %d reviews", status.Model, status.Embedded, status.Total)
+		return false
+	}
+
+	s.shadow.active.Store(true)
+	log.Printf("Switched retrieval to shadow embeddings for %s", status.Model)
+	return true
+}
+
+func coverage(embedded, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(embedded) / float64(total)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/clustering"
+	"github.com/quiby-ai/review-rag/internal/keywords"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const (
+	defaultThemeSampleSize = 2000
+	defaultMaxThemes       = 10
+	// kmeansIterations is plenty for review embeddings, which settle within
+	// a few dozen iterations.
+	kmeansIterations = 50
+	themeKeywords    = 5
+	// themeLabelKeywords of the keywords make up a theme's label.
+	themeLabelKeywords = 3
+	// minThemeReviews is the fewest retrieved reviews worth clustering.
+	minThemeReviews = 4
+)
+
+// Themes clusters the app's most recent reviews by embedding, up to
+// RAGConfig.ThemeSampleSize of them.
+func (s *RAGService) Themes(ctx context.Context, query types.ThemesQuery) (*types.ThemesResponse, error) {
+	startTime := time.Now()
+
+	limit := s.config.ThemeSampleSize
+	if limit <= 0 {
+		limit = defaultThemeSampleSize
+	}
+
+	var since time.Time
+	if query.LastDays > 0 {
+		since = time.Now().AddDate(0, 0, -query.LastDays)
+	}
+
+	reviews, err := s.repo.AppReviewEmbeddings(ctx, query.AppID, since, limit)
+	if err != nil {
+		s.metrics.ObserveError("retrieval")
+		return nil, fmt.Errorf("failed to load review embeddings: %w", err)
+	}
+
+	k := query.K
+	if k == 0 {
+		k = clustering.DefaultK(len(reviews), s.maxThemes())
+	}
+
+	return &types.ThemesResponse{
+		AppID:          query.AppID,
+		ReviewCount:    len(reviews),
+		Themes:         buildThemes(reviews, k, true),
+		ProcessingTime: time.Since(startTime).Seconds(),
+	}, nil
+}
+
+func (s *RAGService) maxThemes() int {
+	if s.config.MaxThemes > 0 {
+		return s.config.MaxThemes
+	}
+	return defaultMaxThemes
+}
+
+// retrievedThemes groups the reviews retrieved for a query. Too few
+// reviews, or reviews without embeddings, give no themes.
+func (s *RAGService) retrievedThemes(reviews []types.RetrievedReview) []types.Theme {
+	if len(reviews) < minThemeReviews {
+		return nil
+	}
+	for _, review := range reviews {
+		if len(review.Embedding) == 0 {
+			return nil
+		}
+	}
+	return buildThemes(reviews, clustering.DefaultK(len(reviews), s.maxThemes()), false)
+}
+
+// buildThemes clusters reviews into at most k themes, largest first, and
+// describes each one. withTrend adds the monthly share of each theme.
+func buildThemes(reviews []types.RetrievedReview, k int, withTrend bool) []types.Theme {
+	vectors := make([][]float32, len(reviews))
+	for i, review := range reviews {
+		vectors[i] = review.Embedding
+	}
+
+	clusters := clustering.KMeans(vectors, k, kmeansIterations)
+
+	documents := make([][]string, len(clusters))
+	for c, cluster := range clusters {
+		documents[c] = make([]string, len(cluster.Members))
+		for j, member := range cluster.Members {
+			documents[c][j] = reviews[member].Title + "\n" + reviews[member].Content
+		}
+	}
+	clusterKeywords := keywords.Distinctive(documents, themeKeywords)
+
+	var monthTotals map[string]int
+	if withTrend {
+		monthTotals = make(map[string]int)
+		for _, review := range reviews {
+			monthTotals[month(review.Date)]++
+		}
+	}
+
+	themes := make([]types.Theme, len(clusters))
+	for c, cluster := range clusters {
+		theme := types.Theme{
+			Label:                 themeLabel(clusterKeywords[c]),
+			Keywords:              clusterKeywords[c],
+			Size:                  len(cluster.Members),
+			Share:                 float64(len(cluster.Members)) / float64(len(reviews)),
+			RepresentativeReviews: []types.RetrievedReview{},
+		}
+
+		var ratingSum int
+		months := make(map[string]int)
+		for j, member := range cluster.Members {
+			review := reviews[member]
+			ratingSum += int(review.Rating)
+			months[month(review.Date)]++
+			if j < representativeReviews {
+				theme.RepresentativeReviews = append(theme.RepresentativeReviews, review)
+			}
+		}
+		theme.AverageRating = float64(ratingSum) / float64(len(cluster.Members))
+
+		if withTrend {
+			theme.Trend = themeTrend(months, monthTotals)
+		}
+
+		themes[c] = theme
+	}
+
+	return themes
+}
+
+// themeTrend lists every month with clustered reviews, oldest first, so
+// months where the theme is absent show up with a zero count.
+func themeTrend(months, monthTotals map[string]int) []types.ThemePeriod {
+	keys := make([]string, 0, len(monthTotals))
+	for key := range monthTotals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	trend := make([]types.ThemePeriod, len(keys))
+	for i, key := range keys {
+		trend[i] = types.ThemePeriod{
+			Month: key,
+			Count: months[key],
+			Share: float64(months[key]) / float64(monthTotals[key]),
+		}
+	}
+	return trend
+}
+
+func themeLabel(terms []string) string {
+	if len(terms) == 0 {
+		return "other"
+	}
+	return strings.Join(terms[:min(len(terms), themeLabelKeywords)], ", ")
+}
+
+func month(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+const (
+	defaultTrendInterval      = "week"
+	defaultTrendDays          = 180
+	defaultTrendMinSimilarity = 0.5
+	defaultTrendAnomalyZ      = 2.0
+	// trendBaseline is how many preceding buckets a bucket is compared with.
+	trendBaseline = 8
+	// minTrendBaseline buckets must precede one before it can be flagged.
+	minTrendBaseline = 4
+	// minAnomalyMatches keeps a jump from one to two reviews from counting
+	// as a spike.
+	minAnomalyMatches = 3
+)
+
+// Trend counts the app's reviews about the query topic per week or month
+// and flags buckets where they spike.
+func (s *RAGService) Trend(ctx context.Context, request types.TrendRequest) (*types.TrendResponse, error) {
+	startTime := time.Now()
+
+	interval := request.Interval
+	if interval == "" {
+		interval = defaultTrendInterval
+	}
+
+	minSimilarity := request.MinSimilarity
+	if minSimilarity == 0 {
+		minSimilarity = s.config.TrendMinSimilarity
+	}
+	if minSimilarity == 0 {
+		minSimilarity = defaultTrendMinSimilarity
+	}
+
+	embedClient, model := s.embeddingTarget()
+
+	embedStart := time.Now()
+	queryEmbedding, err := embedClient.GenerateEmbedding(ctx, request.Query)
+	if err != nil {
+		s.metrics.ObserveError("embedding")
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+	s.metrics.ObserveEmbedding(time.Since(embedStart))
+
+	filters := trendFilters(request.Filters)
+
+	retrievalStart := time.Now()
+	buckets, err := s.repo.SimilarityTrend(ctx, queryEmbedding, model, request.AppID, interval, 1-minSimilarity, filters)
+	if err != nil {
+		s.metrics.ObserveError("retrieval")
+		return nil, fmt.Errorf("failed to compute trend: %w", err)
+	}
+	s.metrics.ObserveRetrieval(request.AppID, time.Since(retrievalStart))
+
+	first, last := trendWindow(filters, interval, time.Now())
+	buckets = fillTrendGaps(buckets, interval, first, last)
+
+	threshold := s.config.TrendAnomalyZ
+	if threshold <= 0 {
+		threshold = defaultTrendAnomalyZ
+	}
+	flagAnomalies(buckets, threshold)
+
+	return &types.TrendResponse{
+		AppID:          request.AppID,
+		Interval:       interval,
+		MinSimilarity:  minSimilarity,
+		Buckets:        buckets,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		QueryHash:      s.embedClient.GetQueryHash(request.Query),
+	}, nil
+}
+
+// trendFilters bounds the trend to the last defaultTrendDays unless the
+// request already sets a start.
+func trendFilters(filters *types.RAGFilters) *types.RAGFilters {
+	bounded := types.RAGFilters{}
+	if filters != nil {
+		bounded = *filters
+	}
+	if bounded.From.IsZero() && bounded.LastDays == 0 {
+		bounded.LastDays = defaultTrendDays
+	}
+	return &bounded
+}
+
+// trendWindow returns the starts of the first and last bucket of the period
+// filters cover. The period ends now unless filters end it earlier.
+func trendWindow(filters *types.RAGFilters, interval string, now time.Time) (time.Time, time.Time) {
+	from := filters.From
+	if from.IsZero() {
+		from = now.AddDate(0, 0, -filters.LastDays)
+	}
+
+	to := now
+	if !filters.To.IsZero() && filters.To.Before(now) {
+		// To is exclusive, so a period ending on a bucket boundary does not
+		// reach into the next bucket.
+		to = filters.To.Add(-time.Nanosecond)
+	}
+
+	return bucketStart(from, interval), bucketStart(to, interval)
+}
+
+// bucketStart truncates t to the start of its bucket the way the trend
+// query's date_trunc does: Monday of the week or the first of the month, UTC.
+func bucketStart(t time.Time, interval string) time.Time {
+	year, month, day := t.UTC().Date()
+	if interval == "month" {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return midnight.AddDate(0, 0, -(int(midnight.Weekday())+6)%7)
+}
+
+// fillTrendGaps inserts empty buckets for periods without reviews, from the
+// bucket starting at first through the one starting at last, so the series
+// has one point per interval of the window, and fills in each bucket's share.
+func fillTrendGaps(buckets []types.TrendBucket, interval string, first, last time.Time) []types.TrendBucket {
+	next := func(t time.Time) time.Time {
+		if interval == "month" {
+			return t.AddDate(0, 1, 0)
+		}
+		return t.AddDate(0, 0, 7)
+	}
+
+	filled := make([]types.TrendBucket, 0, len(buckets))
+	start := first
+	for _, bucket := range buckets {
+		for ; start.Before(bucket.Start); start = next(start) {
+			filled = append(filled, types.TrendBucket{Start: start})
+		}
+		if bucket.Total > 0 {
+			bucket.Share = float64(bucket.Matching) / float64(bucket.Total)
+		}
+		filled = append(filled, bucket)
+		if !bucket.Start.Before(start) {
+			start = next(bucket.Start)
+		}
+	}
+	for ; !start.After(last); start = next(start) {
+		filled = append(filled, types.TrendBucket{Start: start})
+	}
+
+	return filled
+}
+
+// flagAnomalies scores each bucket's matching count against the mean and
+// standard deviation of up to trendBaseline preceding buckets. The deviation
+// is floored at one review so that a flat baseline does not turn every
+// small change into a spike.
+func flagAnomalies(buckets []types.TrendBucket, threshold float64) {
+	for i := range buckets {
+		baseline := buckets[max(0, i-trendBaseline):i]
+		if len(baseline) < minTrendBaseline {
+			continue
+		}
+
+		var sum float64
+		for _, bucket := range baseline {
+			sum += float64(bucket.Matching)
+		}
+		mean := sum / float64(len(baseline))
+
+		var variance float64
+		for _, bucket := range baseline {
+			d := float64(bucket.Matching) - mean
+			variance += d * d
+		}
+		stddev := math.Max(1, math.Sqrt(variance/float64(len(baseline))))
+
+		buckets[i].ZScore = (float64(buckets[i].Matching) - mean) / stddev
+		buckets[i].Anomaly = buckets[i].ZScore >= threshold && buckets[i].Matching >= minAnomalyMatches
+	}
+}
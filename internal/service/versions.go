@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// regressionZ is the two-sided 95% critical value of the standard normal
+// distribution.
+const regressionZ = 1.96
+
+// Regression compares how many of the app's reviews are about the query
+// topic in two versions, to tell whether a release made it worse.
+func (s *RAGService) Regression(ctx context.Context, request types.RegressionRequest) (*types.RegressionResponse, error) {
+	startTime := time.Now()
+
+	minSimilarity := request.MinSimilarity
+	if minSimilarity == 0 {
+		minSimilarity = s.config.TrendMinSimilarity
+	}
+	if minSimilarity == 0 {
+		minSimilarity = defaultTrendMinSimilarity
+	}
+
+	embedClient, model := s.embeddingTarget()
+
+	embedStart := time.Now()
+	queryEmbedding, err := embedClient.GenerateEmbedding(ctx, request.Query)
+	if err != nil {
+		s.metrics.ObserveError("embedding")
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+	s.metrics.ObserveEmbedding(time.Since(embedStart))
+
+	retrievalStart := time.Now()
+	var stats []types.VersionTopicStats
+	var reviews []types.RetrievedReview
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		var err error
+		stats, err = s.repo.VersionTopicStats(gctx, queryEmbedding, model, request.AppID,
+			[]string{request.BaseVersion, request.TargetVersion}, 1-minSimilarity)
+		return err
+	})
+
+	g.Go(func() error {
+		filters := &types.RAGFilters{Versions: []string{request.TargetVersion}}
+		retrieved, err := s.repo.RAGRetrieval(gctx, queryEmbedding, model, s.config.TopK, 0, []string{request.AppID}, filters)
+		if err != nil {
+			return err
+		}
+		reviews = make([]types.RetrievedReview, 0, len(retrieved))
+		for _, review := range retrieved {
+			if review.Similarity >= minSimilarity {
+				reviews = append(reviews, review)
+			}
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		s.metrics.ObserveError("retrieval")
+		return nil, fmt.Errorf("failed to compare versions: %w", err)
+	}
+	s.metrics.ObserveRetrieval(request.AppID, time.Since(retrievalStart))
+
+	if len(stats) != 2 {
+		return nil, fmt.Errorf("failed to compare versions: expected stats for 2 versions, got %d", len(stats))
+	}
+
+	base, target := withShare(stats[0]), withShare(stats[1])
+	z := shareZScore(base, target)
+
+	return &types.RegressionResponse{
+		AppID:          request.AppID,
+		MinSimilarity:  minSimilarity,
+		Base:           base,
+		Target:         target,
+		ShareChange:    target.Share - base.Share,
+		ZScore:         z,
+		Regression:     z >= regressionZ && target.Matching >= minAnomalyMatches,
+		Reviews:        reviews,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		QueryHash:      s.embedClient.GetQueryHash(request.Query),
+	}, nil
+}
+
+func withShare(stats types.VersionTopicStats) types.VersionTopicStats {
+	if stats.Total > 0 {
+		stats.Share = float64(stats.Matching) / float64(stats.Total)
+	}
+	return stats
+}
+
+// shareZScore is the two-proportion z statistic of target's share against
+// base's, positive when the topic became more common. It is 0 when either
+// version has no reviews or neither share can vary.
+func shareZScore(base, target types.VersionTopicStats) float64 {
+	if base.Total == 0 || target.Total == 0 {
+		return 0
+	}
+
+	pooled := float64(base.Matching+target.Matching) / float64(base.Total+target.Total)
+	stderr := math.Sqrt(pooled * (1 - pooled) * (1/float64(base.Total) + 1/float64(target.Total)))
+	if stderr == 0 {
+		return 0
+	}
+
+	return (target.Share - base.Share) / stderr
+}
+
+// versionBreakdowns summarises reviews per app version, in the order each
+// version first appears in the ranking. Reviews without a version are
+// grouped under "unknown".
+func versionBreakdowns(reviews []types.RetrievedReview) []types.VersionBreakdown {
+	var breakdowns []types.VersionBreakdown
+	index := make(map[string]int)
+	var ratingSums []int
+
+	for _, review := range reviews {
+		version := review.AppVersion
+		if version == "" {
+			version = "unknown"
+		}
+
+		i, ok := index[version]
+		if !ok {
+			i = len(breakdowns)
+			index[version] = i
+			breakdowns = append(breakdowns, types.VersionBreakdown{Version: version, TopReviewIDs: []string{}})
+			ratingSums = append(ratingSums, 0)
+		}
+
+		breakdowns[i].ReviewCount++
+		ratingSums[i] += int(review.Rating)
+		if len(breakdowns[i].TopReviewIDs) < breakdownTopReviews {
+			breakdowns[i].TopReviewIDs = append(breakdowns[i].TopReviewIDs, review.ID)
+		}
+	}
+
+	for i := range breakdowns {
+		breakdowns[i].AverageRating = float64(ratingSums[i]) / float64(breakdowns[i].ReviewCount)
+	}
+
+	return breakdowns
+}
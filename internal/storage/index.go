@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// PendingReview is a clean review whose embedding is missing or was built
+// from different content.
+type PendingReview struct {
+	ID      string
+	AppID   string
+	Rating  int16
+	Country string
+	Content string
+}
+
+type ReviewEmbedding struct {
+	ReviewID  string
+	AppID     string
+	Rating    int16
+	Country   string
+	Embedding []float32
+	// ContentHash is the hex SHA-256 of the embedded content; see
+	// indexedContent.
+	ContentHash string
+}
+
+// indexedContent is the text the indexer embeds for a clean review. Its
+// hash is compared in SQL, so it must be computed the same way in Go and in
+// migration 005, which backfills the hashes of existing embeddings.
+const indexedContent = `COALESCE(NULLIF(cr.content_en, ''), cr.content_clean)`
+
+// PendingReviews returns up to limit reviews with an ID greater than
+// afterID, ordered by ID, that have no embedding or whose content changed
+// since it was embedded. An empty model looks at review_embeddings, any
+// other at the shadow embeddings of that model. An empty appID matches
+// every app.
+func (r *postgresRepository) PendingReviews(ctx context.Context, model, appID, afterID string, limit int) ([]PendingReview, error) {
+	join := "LEFT JOIN review_embeddings re ON re.review_id = cr.id"
+	if model != "" {
+		join = "LEFT JOIN review_embeddings_shadow re ON re.review_id = cr.id AND re.model_name = $4"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT cr.id, cr.app_id, cr.rating, cr.country, %[1]s
+		FROM clean_reviews cr
+		%[2]s
+		WHERE
+			cr.id > $1
+			AND ($2 = '' OR cr.app_id = $2)
+			AND COALESCE(%[1]s, '') <> ''
+			AND (re.review_id IS NULL
+				OR re.content_hash IS DISTINCT FROM encode(sha256(convert_to(%[1]s, 'UTF8')), 'hex'))
+		ORDER BY cr.id
+		LIMIT $3;
+	`, indexedContent, join)
+
+	args := []any{afterID, appID, limit}
+	if model != "" {
+		args = append(args, model)
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []PendingReview
+	for rows.Next() {
+		var review PendingReview
+		if err := rows.Scan(&review.ID, &review.AppID, &review.Rating, &review.Country, &review.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan pending review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return reviews, nil
+}
+
+// UpsertReviewEmbeddings writes to review_embeddings when model is empty
+// and to the shadow embeddings of model otherwise.
+func (r *postgresRepository) UpsertReviewEmbeddings(ctx context.Context, model string, embeddings []ReviewEmbedding) error {
+	batch := &pgx.Batch{}
+	for _, e := range embeddings {
+		if model != "" {
+			batch.Queue(`
+				INSERT INTO review_embeddings_shadow (review_id, model_name, app_id, content_vec, content_hash)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (review_id, model_name) DO UPDATE SET
+					app_id = EXCLUDED.app_id,
+					content_vec = EXCLUDED.content_vec,
+					content_hash = EXCLUDED.content_hash,
+					created_at = NOW();
+			`, e.ReviewID, model, e.AppID, pgvector.NewVector(e.Embedding), e.ContentHash)
+			continue
+		}
+
+		batch.Queue(`
+			INSERT INTO review_embeddings (review_id, app_id, rating, country, content_vec, content_hash)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (review_id) DO UPDATE SET
+				app_id = EXCLUDED.app_id,
+				rating = EXCLUDED.rating,
+				country = EXCLUDED.country,
+				content_vec = EXCLUDED.content_vec,
+				content_hash = EXCLUDED.content_hash;
+		`, e.ReviewID, e.AppID, e.Rating, e.Country, pgvector.NewVector(e.Embedding), e.ContentHash)
+	}
+
+	if err := r.db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to upsert review embeddings: %w", err)
+	}
+
+	return nil
+}
+
+// GetIndexCheckpoint returns the last review ID indexed by the run called
+// name, or "" when it has none.
+func (r *postgresRepository) GetIndexCheckpoint(ctx context.Context, name string) (string, error) {
+	var lastReviewID string
+	err := r.db.QueryRow(ctx, `SELECT last_review_id FROM index_checkpoints WHERE name = $1;`, name).Scan(&lastReviewID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get index checkpoint %s: %w", name, err)
+	}
+
+	return lastReviewID, nil
+}
+
+func (r *postgresRepository) SaveIndexCheckpoint(ctx context.Context, name, lastReviewID string) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO index_checkpoints (name, last_review_id)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET
+			last_review_id = EXCLUDED.last_review_id,
+			updated_at = NOW();
+	`, name, lastReviewID)
+	if err != nil {
+		return fmt.Errorf("failed to save index checkpoint %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ShadowCoverage reports, per app, how many reviews in review_embeddings
+// also have a shadow embedding of model built from their current content.
+func (r *postgresRepository) ShadowCoverage(ctx context.Context, model string) ([]types.AppEmbeddingCoverage, error) {
+	return shadowCoverage(ctx, r.db, model)
+}
+
+// querier is what the pool and a transaction have in common.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func shadowCoverage(ctx context.Context, db querier, model string) ([]types.AppEmbeddingCoverage, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT re.app_id, COUNT(*), COUNT(s.review_id)
+		FROM review_embeddings re
+		LEFT JOIN clean_reviews cr ON cr.id = re.review_id
+		LEFT JOIN review_embeddings_shadow s
+			ON s.review_id = re.review_id
+			AND s.model_name = $1
+			AND s.content_hash = encode(sha256(convert_to(%s, 'UTF8')), 'hex')
+		GROUP BY re.app_id
+		ORDER BY re.app_id;
+	`, indexedContent), model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shadow coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []types.AppEmbeddingCoverage
+	for rows.Next() {
+		var app types.AppEmbeddingCoverage
+		if err := rows.Scan(&app.AppID, &app.Total, &app.Embedded); err != nil {
+			return nil, fmt.Errorf("failed to scan shadow coverage: %w", err)
+		}
+		coverage = append(coverage, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return coverage, nil
+}
+
+// ErrShadowIncomplete is returned when shadow embeddings are promoted before
+// every review has a current one.
+var ErrShadowIncomplete = errors.New("shadow embeddings do not cover every review")
+
+// PromoteShadowEmbeddings replaces the vectors in review_embeddings with the
+// shadow embeddings of model, resizes content_vec to their dimension,
+// rebuilds the HNSW index and records model as the table's model. It runs in
+// one transaction, which locks review_embeddings until the index is built
+// and blocks writes to the shadow embeddings, so concurrent indexing cannot
+// change coverage between the check and the copy. Shadow rows are kept, so a service still searching them keeps working
+// until it is restarted with the new model. It returns the number of
+// promoted reviews.
+func (r *postgresRepository) PromoteShadowEmbeddings(ctx context.Context, model string) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin promotion: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, statement := range []string{
+		`LOCK TABLE review_embeddings IN ACCESS EXCLUSIVE MODE;`,
+		`LOCK TABLE review_embeddings_shadow IN SHARE MODE;`,
+	} {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return 0, fmt.Errorf("failed to lock embeddings: %w", err)
+		}
+	}
+
+	coverage, err := shadowCoverage(ctx, tx, model)
+	if err != nil {
+		return 0, err
+	}
+	for _, app := range coverage {
+		if app.Embedded < app.Total {
+			return 0, fmt.Errorf("%w: %s has %d of %d", ErrShadowIncomplete, app.AppID, app.Embedded, app.Total)
+		}
+	}
+
+	var dimensions int
+	err = tx.QueryRow(ctx, `
+		SELECT vector_dims(content_vec) FROM review_embeddings_shadow WHERE model_name = $1 LIMIT 1;
+	`, model).Scan(&dimensions)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s has no shadow embeddings", ErrShadowIncomplete, model)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read shadow dimensions: %w", err)
+	}
+
+	// The index must go before the column type changes, and the column is
+	// made dimensionless so vectors of the new size can be written to it.
+	for _, statement := range []string{
+		`DROP INDEX IF EXISTS idx_review_embeddings_hnsw;`,
+		`ALTER TABLE review_embeddings ALTER COLUMN content_vec TYPE vector;`,
+	} {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return 0, fmt.Errorf("failed to prepare review_embeddings: %w", err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE review_embeddings re
+		SET content_vec = s.content_vec, content_hash = s.content_hash
+		FROM review_embeddings_shadow s
+		WHERE s.review_id = re.review_id AND s.model_name = $1;
+	`, model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy shadow embeddings: %w", err)
+	}
+
+	// Same index definition as migration 001.
+	for _, statement := range []string{
+		fmt.Sprintf(`ALTER TABLE review_embeddings ALTER COLUMN content_vec TYPE vector(%d);`, dimensions),
+		`CREATE INDEX idx_review_embeddings_hnsw ON review_embeddings USING hnsw (content_vec vector_cosine_ops) WITH (m=16, ef_construction=64);`,
+	} {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return 0, fmt.Errorf("failed to rebuild review_embeddings index: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO embedding_models (table_name, model_name, dimensions)
+		VALUES ('review_embeddings', $1, $2)
+		ON CONFLICT (table_name) DO UPDATE SET
+			model_name = EXCLUDED.model_name,
+			dimensions = EXCLUDED.dimensions,
+			recorded_at = NOW();
+	`, model, dimensions); err != nil {
+		return 0, fmt.Errorf("failed to record embedding model for review_embeddings: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit promotion: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
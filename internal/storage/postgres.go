@@ -2,9 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
 	"github.com/quiby-ai/review-rag/internal/types"
@@ -13,9 +17,27 @@ import (
 type Repository interface {
 	SearchSimilarReviews(ctx context.Context, queryEmbedding []float32, appID string, topN int, annProbes int) ([]types.RetrievedReview, error)
 	GetReviewDetails(ctx context.Context, reviewIDs []string) (map[string]ReviewDetails, error)
-	RAGRetrieval(ctx context.Context, queryEmbedding []float32, topK int, appID string) ([]types.RetrievedReview, error)
-	InitRAGTables(ctx context.Context) error
+	RAGRetrieval(ctx context.Context, queryEmbedding []float32, model string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error)
+	KeywordRetrieval(ctx context.Context, queryEmbedding []float32, model string, queryText string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error)
+	GetCachedEmbeddings(ctx context.Context, textHashes []string, model string) (map[string][]float32, error)
+	StoreCachedEmbedding(ctx context.Context, textHash, text, model string, embedding []float32, expiresAt time.Time) error
+	CleanupExpiredEmbeddings(ctx context.Context) error
+	LogQuery(ctx context.Context, entry QueryLogEntry) error
+	RecordMetrics(ctx context.Context, metrics []types.Metric) error
 	HealthCheck(ctx context.Context) error
+	MissingSchemaObjects(ctx context.Context, tables []string) ([]string, error)
+	VectorDimensions(ctx context.Context, table, column string) (int, error)
+	GetEmbeddingModel(ctx context.Context, table string) (model string, dimensions int, found bool, err error)
+	RecordEmbeddingModel(ctx context.Context, table, model string, dimensions int) error
+	PendingReviews(ctx context.Context, model, appID, afterID string, limit int) ([]PendingReview, error)
+	UpsertReviewEmbeddings(ctx context.Context, model string, embeddings []ReviewEmbedding) error
+	ShadowCoverage(ctx context.Context, model string) ([]types.AppEmbeddingCoverage, error)
+	PromoteShadowEmbeddings(ctx context.Context, model string) (int, error)
+	GetIndexCheckpoint(ctx context.Context, name string) (string, error)
+	SaveIndexCheckpoint(ctx context.Context, name, lastReviewID string) error
+	AppReviewEmbeddings(ctx context.Context, appID string, since time.Time, limit int) ([]types.RetrievedReview, error)
+	VersionTopicStats(ctx context.Context, queryEmbedding []float32, model, appID string, versions []string, maxDistance float64) ([]types.VersionTopicStats, error)
+	SimilarityTrend(ctx context.Context, queryEmbedding []float32, model, appID, interval string, maxDistance float64, filters *types.RAGFilters) ([]types.TrendBucket, error)
 	Close() error
 }
 
@@ -28,136 +50,71 @@ type ReviewDetails struct {
 	HelpfulCount *int
 }
 
+type QueryLogEntry struct {
+	QueryHash        string
+	AppID            string
+	QueryText        string
+	ProcessingTimeMs int
+	ResultCount      int
+	Confidence       float64
+}
+
 type postgresRepository struct {
 	db *pgxpool.Pool
+
+	versionMu        sync.Mutex
+	versionCheckedAt time.Time
+	hasVersion       bool
 }
 
-func NewPostgresRepository(dsn string) (Repository, error) {
-	pool, err := pgxpool.New(context.Background(), dsn)
+// versionColumn is the optional clean_reviews column with the app version a
+// review was written for. Not every review pipeline fills it in.
+const versionColumn = "app_version"
+
+// versionCheckTTL is how long the answer of hasVersionColumn is reused, so
+// a column added or dropped while the service runs is noticed.
+const versionCheckTTL = time.Minute
+
+// ErrNoVersionColumn is returned when a request needs review versions but
+// clean_reviews has no app_version column.
+var ErrNoVersionColumn = errors.New("clean_reviews has no " + versionColumn + " column")
+
+// hnswEfSearch is the size of the HNSW candidate list. It is a session
+// setting, so it is applied to every pooled connection.
+const hnswEfSearch = "96"
+
+// hnswIterativeScan makes an HNSW index scan keep fetching candidates until
+// enough of them pass the query's filters, rather than stopping after
+// ef_search. Without it a filtered search, such as one app among many or
+// one app version, can return fewer rows than asked for. It needs pgvector
+// 0.8 or later; older versions ignore the setting.
+const hnswIterativeScan = "strict_order"
+
+// NewPool connects to Postgres. The schema is managed by the migrate
+// package rather than by the repository.
+func NewPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to parse database DSN: %w", err)
 	}
+	poolConfig.ConnConfig.RuntimeParams["hnsw.ef_search"] = hnswEfSearch
+	poolConfig.ConnConfig.RuntimeParams["hnsw.iterative_scan"] = hnswIterativeScan
 
-	if err := pool.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	repo := &postgresRepository{db: pool}
-
-	if err := repo.initTables(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to initialize tables: %w", err)
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return repo, nil
+	return pool, nil
 }
 
-func (r *postgresRepository) initTables(ctx context.Context) error {
-	queries := []string{
-		`CREATE EXTENSION IF NOT EXISTS vector;`,
-		`SET hnsw.ef_search = 96;`,
-	}
-
-	indexQueries := []string{
-		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_hnsw ON review_embeddings USING hnsw (content_vec vector_cosine_ops) WITH (m=16, ef_construction=64);`,
-		// `CREATE INDEX IF NOT EXISTS idx_review_embeddings_app_id ON review_embeddings(app_id);`,
-		// `CREATE INDEX IF NOT EXISTS idx_review_embeddings_country ON review_embeddings(country);`,
-		// `CREATE INDEX IF NOT EXISTS idx_review_embeddings_review_id ON review_embeddings(review_id);`,
-		// `CREATE INDEX IF NOT EXISTS idx_clean_reviews_app_id ON clean_reviews(app_id);`,
-		// `CREATE INDEX IF NOT EXISTS idx_clean_reviews_country ON clean_reviews(country);`,
-		// `CREATE INDEX IF NOT EXISTS idx_clean_reviews_reviewed_at ON clean_reviews(reviewed_at);`,
-	}
-
-	for i, query := range queries {
-		if _, err := r.db.Exec(ctx, query); err != nil {
-			return fmt.Errorf("failed to execute query %d: %w", i+1, err)
-		}
-	}
-
-	for _, query := range indexQueries {
-		if _, err := r.db.Exec(ctx, query); err != nil {
-			continue
-		}
-	}
-
-	return nil
-}
-
-func (r *postgresRepository) InitRAGTables(ctx context.Context) error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS rag_query_logs (
-			id SERIAL PRIMARY KEY,
-			query_hash VARCHAR(64) NOT NULL,
-			app_id VARCHAR(255) NOT NULL,
-			query_text TEXT NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			processing_time_ms INTEGER,
-			result_count INTEGER,
-			confidence_score DECIMAL(3,2)
-		);`,
-
-		`CREATE INDEX IF NOT EXISTS idx_rag_query_logs_query_hash ON rag_query_logs(query_hash);`,
-		`CREATE INDEX IF NOT EXISTS idx_rag_query_logs_app_id ON rag_query_logs(app_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_rag_query_logs_created_at ON rag_query_logs(created_at);`,
-
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_rag_query_logs_app_id_query_hash_unique ON rag_query_logs(app_id, query_hash);`,
-
-		`CREATE TABLE IF NOT EXISTS embedding_cache (
-			id SERIAL PRIMARY KEY,
-			text_hash VARCHAR(64) UNIQUE NOT NULL,
-			text_content TEXT NOT NULL,
-			embedding_vector vector(1536) NOT NULL,
-			model_name VARCHAR(100) NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
-		);`,
-
-		`CREATE INDEX IF NOT EXISTS idx_embedding_cache_text_hash ON embedding_cache(text_hash);`,
-		`CREATE INDEX IF NOT EXISTS idx_embedding_cache_expires_at ON embedding_cache(expires_at);`,
-
-		`CREATE TABLE IF NOT EXISTS rag_metrics (
-			id SERIAL PRIMARY KEY,
-			metric_name VARCHAR(100) NOT NULL,
-			metric_value DECIMAL(10,4) NOT NULL,
-			app_id VARCHAR(255),
-			timestamp TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		);`,
-
-		`CREATE INDEX IF NOT EXISTS idx_rag_metrics_name_timestamp ON rag_metrics(metric_name, timestamp);`,
-		`CREATE INDEX IF NOT EXISTS idx_rag_metrics_app_id ON rag_metrics(app_id);`,
-
-		`INSERT INTO rag_metrics (metric_name, metric_value, app_id) VALUES
-		('avg_query_time_ms', 0.0, NULL),
-		('total_queries', 0.0, NULL),
-		('avg_confidence_score', 0.0, NULL)
-		ON CONFLICT DO NOTHING;`,
-
-		`CREATE OR REPLACE FUNCTION cleanup_expired_embeddings()
-		RETURNS void AS $$
-		BEGIN
-			DELETE FROM embedding_cache WHERE expires_at < NOW();
-		END;
-		$$ LANGUAGE plpgsql;`,
-
-		`CREATE OR REPLACE FUNCTION update_rag_metrics(
-			p_metric_name VARCHAR(100),
-			p_metric_value DECIMAL(10,4),
-			p_app_id VARCHAR(255) DEFAULT NULL
-		)
-		RETURNS void AS $$
-		BEGIN
-			INSERT INTO rag_metrics (metric_name, metric_value, app_id)
-			VALUES (p_metric_name, p_metric_value, p_app_id);
-		END;
-		$$ LANGUAGE plpgsql;`,
-	}
-
-	for i, query := range queries {
-		if _, err := r.db.Exec(ctx, query); err != nil {
-			return fmt.Errorf("failed to execute RAG table query %d: %w", i+1, err)
-		}
-	}
-
-	return nil
+func NewPostgresRepository(pool *pgxpool.Pool) Repository {
+	return &postgresRepository{db: pool}
 }
 
 func (r *postgresRepository) SearchSimilarReviews(ctx context.Context, queryEmbedding []float32, appID string, topN int, annProbes int) ([]types.RetrievedReview, error) {
@@ -263,44 +220,220 @@ func (r *postgresRepository) GetReviewDetails(ctx context.Context, reviewIDs []s
 	return details, nil
 }
 
-func (r *postgresRepository) RAGRetrieval(ctx context.Context, queryEmbedding []float32, topK int, appID string) ([]types.RetrievedReview, error) {
+// RAGRetrieval ranks the reviews of appIDs by distance to queryEmbedding,
+// taking at most perApp from each app; perApp <= 0 means topK. An empty
+// model searches review_embeddings, any other the shadow embeddings of that
+// model.
+func (r *postgresRepository) RAGRetrieval(ctx context.Context, queryEmbedding []float32, model string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error) {
 	queryVec := pgvector.NewVector(queryEmbedding)
 
 	if topK <= 0 {
 		topK = 20
 	}
+	if perApp <= 0 {
+		perApp = topK
+	}
 
-	query := `
-		SELECT
-			cr.id,
-			cr.app_id,
-			cr.title,
-			cr.content_clean AS content,
-			cr.response_content_clean AS response_content,
-			cr.rating,
-			cr.country,
-			cr.language,
-			cr.reviewed_at AS date,
-			(re.content_vec <=> $1) AS distance
-		FROM review_embeddings re
-		JOIN clean_reviews cr ON cr.id = re.review_id
-		WHERE
-			cr.app_id = $3
-		ORDER BY re.content_vec <=> $1
+	version, err := r.versionExpr(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{queryVec, topK, appIDs, perApp}
+	source, args := embeddingSource(model, "apps.app_id", args)
+	filterClause, args := buildFilterClause(filters, args)
+
+	// Each app is searched on its own so that a large app cannot take every
+	// slot. The index scan is over all apps' embeddings, so a small app's
+	// reviews are only found in full thanks to hnswIterativeScan.
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM unnest($3::text[]) AS apps(app_id)
+		CROSS JOIN LATERAL (
+			SELECT
+				%s,
+				(re.content_vec <=> $1) AS distance,
+				re.content_vec
+			FROM %s re
+			JOIN clean_reviews cr ON cr.id = re.review_id
+			WHERE
+				cr.app_id = apps.app_id%s
+			ORDER BY re.content_vec <=> $1
+			LIMIT $4
+		) r
+		ORDER BY r.distance
 		LIMIT $2;
-	`
+	`, retrievedColumns, reviewColumns(version), source, filterClause)
 
-	rows, err := r.db.Query(ctx, query, queryVec, topK, appID)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute RAG retrieval query: %w", err)
 	}
 	defer rows.Close()
 
+	return scanRetrievedReviews(rows)
+}
+
+// KeywordRetrieval ranks the embedded reviews of appIDs by full-text match
+// against queryText, taking at most perApp from each app. Any query term may
+// match, so reviews mentioning an exact feature name or error code surface
+// even when their embedding is not close.
+func (r *postgresRepository) KeywordRetrieval(ctx context.Context, queryEmbedding []float32, model string, queryText string, topK, perApp int, appIDs []string, filters *types.RAGFilters) ([]types.RetrievedReview, error) {
+	queryVec := pgvector.NewVector(queryEmbedding)
+
+	if topK <= 0 {
+		topK = 20
+	}
+	if perApp <= 0 {
+		perApp = topK
+	}
+
+	version, err := r.versionExpr(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{queryVec, topK, appIDs, perApp, queryText}
+	source, args := embeddingSource(model, "apps.app_id", args)
+	filterClause, args := buildFilterClause(filters, args)
+
+	// The OR query is assembled from the query's lexemes, each quoted so
+	// that none can be read as tsquery syntax.
+	query := fmt.Sprintf(`
+		WITH q AS (
+			SELECT COALESCE(string_agg(
+				'''' || replace(replace(lexeme, '\', '\\'), '''', '''''') || '''', ' | '
+			), '')::tsquery AS tsq
+			FROM unnest(tsvector_to_array(to_tsvector('english', $5))) AS lexeme
+		)
+		SELECT %s
+		FROM unnest($3::text[]) AS apps(app_id)
+		CROSS JOIN q
+		CROSS JOIN LATERAL (
+			SELECT
+				%s,
+				(re.content_vec <=> $1) AS distance,
+				re.content_vec,
+				ts_rank(%s, q.tsq) AS rank
+			FROM %s re
+			JOIN clean_reviews cr ON cr.id = re.review_id
+			WHERE
+				cr.app_id = apps.app_id
+				AND %s @@ q.tsq%s
+			ORDER BY rank DESC
+			LIMIT $4
+		) r
+		ORDER BY r.rank DESC
+		LIMIT $2;
+	`, retrievedColumns, reviewColumns(version), reviewDocument, source, reviewDocument, filterClause)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute keyword retrieval query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRetrievedReviews(rows)
+}
+
+// reviewColumns are the clean_reviews fields of a retrieved review, with
+// version as its app version; retrievedColumns selects them, with distance
+// and vector, from the per-app subquery r in the order scanRetrievedReviews
+// expects.
+func reviewColumns(version string) string {
+	return `cr.id,
+				cr.app_id,
+				cr.title,
+				cr.content_clean AS content,
+				cr.response_content_clean AS response_content,
+				cr.rating,
+				cr.country,
+				cr.language,
+				cr.reviewed_at AS date,
+				` + version + ` AS app_version`
+}
+
+const retrievedColumns = `r.id, r.app_id, r.title, r.content, r.response_content, r.rating,
+			r.country, r.language, r.date, r.app_version, r.distance, r.content_vec`
+
+// versionExpr returns the SQL for a review's app version: the app_version
+// column, or NULL when clean_reviews has none. Filtering by version without
+// the column fails with ErrNoVersionColumn.
+func (r *postgresRepository) versionExpr(ctx context.Context, filters *types.RAGFilters) (string, error) {
+	present, err := r.hasVersionColumn(ctx)
+	if err != nil {
+		return "", err
+	}
+	if present {
+		return "cr." + versionColumn, nil
+	}
+	if filters != nil && len(filters.Versions) > 0 {
+		return "", ErrNoVersionColumn
+	}
+	return "NULL::text", nil
+}
+
+// hasVersionColumn looks up whether clean_reviews has the version column.
+// The answer is remembered for versionCheckTTL; a failed lookup is retried
+// on the next call. The lookup runs without holding versionMu, so a slow
+// catalog query does not queue every other request behind it; concurrent
+// callers after expiry may each look up the column once.
+func (r *postgresRepository) hasVersionColumn(ctx context.Context) (bool, error) {
+	r.versionMu.Lock()
+	if !r.versionCheckedAt.IsZero() && time.Since(r.versionCheckedAt) < versionCheckTTL {
+		present := r.hasVersion
+		r.versionMu.Unlock()
+		return present, nil
+	}
+	r.versionMu.Unlock()
+
+	var present bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_attribute
+			WHERE attrelid = to_regclass('clean_reviews') AND attname = $1 AND NOT attisdropped
+		);
+	`, versionColumn).Scan(&present)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s column: %w", versionColumn, err)
+	}
+
+	r.versionMu.Lock()
+	r.versionCheckedAt = time.Now()
+	r.hasVersion = present
+	r.versionMu.Unlock()
+
+	return present, nil
+}
+
+// embeddingSource returns the relation retrieval reads vectors from: the
+// primary review_embeddings table, or the shadow rows of model. Shadow
+// vectors have no fixed dimension and so no ANN index; they are narrowed
+// to the app given by the SQL expression app before the exact scan.
+func embeddingSource(model, app string, args []any) (string, []any) {
+	if model == "" {
+		return "review_embeddings", args
+	}
+
+	args = append(args, model)
+	return fmt.Sprintf(`(
+			SELECT review_id, content_vec
+			FROM review_embeddings_shadow
+			WHERE model_name = $%d AND app_id = %s
+		)`, len(args), app), args
+}
+
+// reviewDocument must match the expression of idx_clean_reviews_fts for the
+// index to be used.
+const reviewDocument = `to_tsvector('english', COALESCE(cr.title, '') || ' ' || COALESCE(cr.content_clean, ''))`
+
+func scanRetrievedReviews(rows pgx.Rows) ([]types.RetrievedReview, error) {
 	var reviews []types.RetrievedReview
 	for rows.Next() {
 		var review types.RetrievedReview
 		var distance float64
-		var responseContent *string
+		var responseContent, appVersion *string
+		var embedding pgvector.Vector
 
 		if err := rows.Scan(
 			&review.ID,
@@ -312,14 +445,20 @@ func (r *postgresRepository) RAGRetrieval(ctx context.Context, queryEmbedding []
 			&review.Country,
 			&review.Language,
 			&review.Date,
+			&appVersion,
 			&distance,
+			&embedding,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan review: %w", err)
 		}
 
 		review.ResponseContent = responseContent
+		if appVersion != nil {
+			review.AppVersion = *appVersion
+		}
 		review.Distance = distance
 		review.Similarity = 1.0 - distance
+		review.Embedding = embedding.Slice()
 		reviews = append(reviews, review)
 	}
 
@@ -330,10 +469,245 @@ func (r *postgresRepository) RAGRetrieval(ctx context.Context, queryEmbedding []
 	return reviews, nil
 }
 
+// buildFilterClause appends the filter values to args and returns the
+// matching " AND ..." conditions on clean_reviews (aliased cr).
+func buildFilterClause(filters *types.RAGFilters, args []any) (string, []any) {
+	if filters == nil {
+		return "", args
+	}
+
+	var conditions []string
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filters.MinRating > 0 {
+		add("cr.rating >= $%d", filters.MinRating)
+	}
+	if filters.MaxRating > 0 {
+		add("cr.rating <= $%d", filters.MaxRating)
+	}
+	if len(filters.Countries) > 0 {
+		add("LOWER(cr.country) = ANY($%d)", lowerAll(filters.Countries))
+	}
+	if len(filters.Languages) > 0 {
+		add("LOWER(cr.language) = ANY($%d)", lowerAll(filters.Languages))
+	}
+	if !filters.From.IsZero() {
+		add("cr.reviewed_at >= $%d", filters.From)
+	}
+	if filters.LastDays > 0 {
+		add("cr.reviewed_at >= NOW() - make_interval(days => $%d)", filters.LastDays)
+	}
+	if !filters.To.IsZero() {
+		add("cr.reviewed_at < $%d", filters.To)
+	}
+	if len(filters.Versions) > 0 {
+		add("cr."+versionColumn+" = ANY($%d)", filters.Versions)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "\n\t\t\tAND " + strings.Join(conditions, "\n\t\t\tAND "), args
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
+
+func (r *postgresRepository) GetCachedEmbeddings(ctx context.Context, textHashes []string, model string) (map[string][]float32, error) {
+	query := `
+		SELECT text_hash, embedding_vector
+		FROM embedding_cache
+		WHERE text_hash = ANY($1)
+			AND model_name = $2
+			AND expires_at > NOW();
+	`
+
+	rows, err := r.db.Query(ctx, query, textHashes, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding cache: %w", err)
+	}
+	defer rows.Close()
+
+	cached := make(map[string][]float32, len(textHashes))
+	for rows.Next() {
+		var textHash string
+		var vec pgvector.Vector
+		if err := rows.Scan(&textHash, &vec); err != nil {
+			return nil, fmt.Errorf("failed to scan cached embedding: %w", err)
+		}
+		cached[textHash] = vec.Slice()
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return cached, nil
+}
+
+func (r *postgresRepository) StoreCachedEmbedding(ctx context.Context, textHash, text, model string, embedding []float32, expiresAt time.Time) error {
+	query := `
+		INSERT INTO embedding_cache (text_hash, text_content, embedding_vector, model_name, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (text_hash, model_name) DO UPDATE SET
+			text_content = EXCLUDED.text_content,
+			embedding_vector = EXCLUDED.embedding_vector,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at;
+	`
+
+	if _, err := r.db.Exec(ctx, query, textHash, text, pgvector.NewVector(embedding), model, expiresAt); err != nil {
+		return fmt.Errorf("failed to store cached embedding: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) CleanupExpiredEmbeddings(ctx context.Context) error {
+	if _, err := r.db.Exec(ctx, `SELECT cleanup_expired_embeddings();`); err != nil {
+		return fmt.Errorf("failed to cleanup expired embeddings: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) LogQuery(ctx context.Context, entry QueryLogEntry) error {
+	query := `
+		INSERT INTO rag_query_logs (query_hash, app_id, query_text, processing_time_ms, result_count, confidence_score)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (app_id, query_hash) DO UPDATE SET
+			processing_time_ms = EXCLUDED.processing_time_ms,
+			result_count = EXCLUDED.result_count,
+			confidence_score = EXCLUDED.confidence_score,
+			hit_count = rag_query_logs.hit_count + 1,
+			last_seen_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query,
+		entry.QueryHash,
+		entry.AppID,
+		entry.QueryText,
+		entry.ProcessingTimeMs,
+		entry.ResultCount,
+		entry.Confidence,
+	); err != nil {
+		return fmt.Errorf("failed to log query: %w", err)
+	}
+
+	return nil
+}
+
+// RecordMetrics records metrics in one transaction, so a failure leaves
+// none of them written and the caller can retry the whole set.
+func (r *postgresRepository) RecordMetrics(ctx context.Context, metrics []types.Metric) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin recording metrics: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, metric := range metrics {
+		if _, err := tx.Exec(ctx, `SELECT update_rag_metrics($1, $2, $3);`, metric.Name, metric.Value, metric.AppID); err != nil {
+			return fmt.Errorf("failed to record metric %s: %w", metric.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit metrics: %w", err)
+	}
+
+	return nil
+}
+
 func (r *postgresRepository) HealthCheck(ctx context.Context) error {
 	return r.db.Ping(ctx)
 }
 
+// MissingSchemaObjects returns "extension vector" when pgvector is not
+// installed, followed by each of tables that does not exist.
+func (r *postgresRepository) MissingSchemaObjects(ctx context.Context, tables []string) ([]string, error) {
+	var missing []string
+
+	var hasVector bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector');`).Scan(&hasVector); err != nil {
+		return nil, fmt.Errorf("failed to check pgvector extension: %w", err)
+	}
+	if !hasVector {
+		missing = append(missing, "extension vector")
+	}
+
+	for _, table := range tables {
+		var exists bool
+		if err := r.db.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL;`, table).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check table %s: %w", table, err)
+		}
+		if !exists {
+			missing = append(missing, table)
+		}
+	}
+
+	return missing, nil
+}
+
+// VectorDimensions returns the declared dimension of a vector column, or 0
+// when the column has none. pgvector stores it as the type modifier.
+func (r *postgresRepository) VectorDimensions(ctx context.Context, table, column string) (int, error) {
+	var dimensions int
+	err := r.db.QueryRow(ctx, `
+		SELECT atttypmod
+		FROM pg_attribute
+		WHERE attrelid = to_regclass($1) AND attname = $2 AND NOT attisdropped;
+	`, table, column).Scan(&dimensions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read dimensions of %s.%s: %w", table, column, err)
+	}
+
+	return max(dimensions, 0), nil
+}
+
+// GetEmbeddingModel returns the model recorded as having produced the
+// vectors in table.
+func (r *postgresRepository) GetEmbeddingModel(ctx context.Context, table string) (string, int, bool, error) {
+	var model string
+	var dimensions int
+	err := r.db.QueryRow(ctx, `
+		SELECT model_name, dimensions FROM embedding_models WHERE table_name = $1;
+	`, table).Scan(&model, &dimensions)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, false, nil
+	}
+	if err != nil {
+		return "", 0, false, fmt.Errorf("failed to get embedding model for %s: %w", table, err)
+	}
+
+	return model, dimensions, true, nil
+}
+
+func (r *postgresRepository) RecordEmbeddingModel(ctx context.Context, table, model string, dimensions int) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO embedding_models (table_name, model_name, dimensions)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (table_name) DO UPDATE SET
+			model_name = EXCLUDED.model_name,
+			dimensions = EXCLUDED.dimensions,
+			recorded_at = NOW();
+	`, table, model, dimensions)
+	if err != nil {
+		return fmt.Errorf("failed to record embedding model for %s: %w", table, err)
+	}
+
+	return nil
+}
+
 func (r *postgresRepository) Close() error {
 	r.db.Close()
 	return nil
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-rag/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFilterClause(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		filters    *types.RAGFilters
+		conditions []string
+		args       []any
+	}{
+		{
+			name: "nil filters",
+		},
+		{
+			name:    "empty filters",
+			filters: &types.RAGFilters{},
+		},
+		{
+			name:       "rating range",
+			filters:    &types.RAGFilters{MinRating: 1, MaxRating: 2},
+			conditions: []string{"cr.rating >= $4", "cr.rating <= $5"},
+			args:       []any{int16(1), int16(2)},
+		},
+		{
+			name:       "max rating only",
+			filters:    &types.RAGFilters{MaxRating: 3},
+			conditions: []string{"cr.rating <= $4"},
+			args:       []any{int16(3)},
+		},
+		{
+			name:       "countries and languages",
+			filters:    &types.RAGFilters{Countries: []string{"DE", "at"}, Languages: []string{"de"}},
+			conditions: []string{"LOWER(cr.country) = ANY($4)", "LOWER(cr.language) = ANY($5)"},
+			args:       []any{[]string{"de", "at"}, []string{"de"}},
+		},
+		{
+			name:       "date range",
+			filters:    &types.RAGFilters{From: from, To: to},
+			conditions: []string{"cr.reviewed_at >= $4", "cr.reviewed_at < $5"},
+			args:       []any{from, to},
+		},
+		{
+			name:       "last days",
+			filters:    &types.RAGFilters{LastDays: 30},
+			conditions: []string{"cr.reviewed_at >= NOW() - make_interval(days => $4)"},
+			args:       []any{30},
+		},
+		{
+			name:       "versions",
+			filters:    &types.RAGFilters{Versions: []string{"5.2.0", "5.2.1"}},
+			conditions: []string{"cr.app_version = ANY($4)"},
+			args:       []any{[]string{"5.2.0", "5.2.1"}},
+		},
+		{
+			name:    "low ratings from germany in the last 30 days",
+			filters: &types.RAGFilters{MinRating: 1, MaxRating: 2, Countries: []string{"de"}, LastDays: 30},
+			conditions: []string{
+				"cr.rating >= $4",
+				"cr.rating <= $5",
+				"LOWER(cr.country) = ANY($6)",
+				"cr.reviewed_at >= NOW() - make_interval(days => $7)",
+			},
+			args: []any{int16(1), int16(2), []string{"de"}, 30},
+		},
+		{
+			name:    "everything",
+			filters: &types.RAGFilters{MinRating: 4, MaxRating: 5, Countries: []string{"us"}, Languages: []string{"en"}, From: from, To: to},
+			conditions: []string{
+				"cr.rating >= $4",
+				"cr.rating <= $5",
+				"LOWER(cr.country) = ANY($6)",
+				"LOWER(cr.language) = ANY($7)",
+				"cr.reviewed_at >= $8",
+				"cr.reviewed_at < $9",
+			},
+			args: []any{int16(4), int16(5), []string{"us"}, []string{"en"}, from, to},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseArgs := []any{"vec", 5, "app"}
+
+			clause, args := buildFilterClause(tt.filters, baseArgs)
+
+			assert.Equal(t, append([]any{"vec", 5, "app"}, tt.args...), args)
+			if len(tt.conditions) == 0 {
+				assert.Empty(t, clause)
+				return
+			}
+			for _, condition := range tt.conditions {
+				assert.Contains(t, clause, "AND "+condition)
+			}
+		})
+	}
+}
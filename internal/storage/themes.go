@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// AppReviewEmbeddings returns up to limit of the app's most recent embedded
+// reviews with their vectors, for clustering. A zero since includes every
+// review. Distance and similarity are left zero as there is no query.
+func (r *postgresRepository) AppReviewEmbeddings(ctx context.Context, appID string, since time.Time, limit int) ([]types.RetrievedReview, error) {
+	version, err := r.versionExpr(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s,
+			re.content_vec
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE
+			cr.app_id = $1
+			AND ($2::timestamptz IS NULL OR cr.reviewed_at >= $2)
+		ORDER BY cr.reviewed_at DESC, cr.id
+		LIMIT $3;
+	`, reviewColumns(version))
+
+	var sinceArg *time.Time
+	if !since.IsZero() {
+		sinceArg = &since
+	}
+
+	rows, err := r.db.Query(ctx, query, appID, sinceArg, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query app review embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []types.RetrievedReview
+	for rows.Next() {
+		var review types.RetrievedReview
+		var appVersion *string
+		var embedding pgvector.Vector
+
+		if err := rows.Scan(
+			&review.ID,
+			&review.AppID,
+			&review.Title,
+			&review.Content,
+			&review.ResponseContent,
+			&review.Rating,
+			&review.Country,
+			&review.Language,
+			&review.Date,
+			&appVersion,
+			&embedding,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan review embedding: %w", err)
+		}
+
+		if appVersion != nil {
+			review.AppVersion = *appVersion
+		}
+		review.Embedding = embedding.Slice()
+		reviews = append(reviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return reviews, nil
+}
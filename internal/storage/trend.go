@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// SimilarityTrend counts, per interval ("week" or "month", in UTC), the
+// app's embedded reviews and how many of them lie within maxDistance of
+// queryEmbedding, with the matching reviews' average rating. Buckets without
+// any review are omitted. Every review in range is compared, so the filters
+// should bound the period.
+func (r *postgresRepository) SimilarityTrend(ctx context.Context, queryEmbedding []float32, model, appID, interval string, maxDistance float64, filters *types.RAGFilters) ([]types.TrendBucket, error) {
+	if _, err := r.versionExpr(ctx, filters); err != nil {
+		return nil, err
+	}
+
+	args := []any{pgvector.NewVector(queryEmbedding), appID, maxDistance, interval}
+	source, args := embeddingSource(model, "$2", args)
+	filterClause, args := buildFilterClause(filters, args)
+
+	query := fmt.Sprintf(`
+		SELECT
+			date_trunc($4, cr.reviewed_at AT TIME ZONE 'UTC') AS bucket,
+			COUNT(*) FILTER (WHERE re.content_vec <=> $1 <= $3) AS matching,
+			COUNT(*) AS total,
+			COALESCE(AVG(cr.rating) FILTER (WHERE re.content_vec <=> $1 <= $3), 0)::float8 AS average_rating
+		FROM %s re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE
+			cr.app_id = $2%s
+		GROUP BY bucket
+		ORDER BY bucket;
+	`, source, filterClause)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute trend query: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []types.TrendBucket
+	for rows.Next() {
+		var bucket types.TrendBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Matching, &bucket.Total, &bucket.AverageRating); err != nil {
+			return nil, fmt.Errorf("failed to scan trend bucket: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return buckets, nil
+}
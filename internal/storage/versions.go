@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/quiby-ai/review-rag/internal/types"
+)
+
+// VersionTopicStats counts, for each of versions, the app's embedded
+// reviews and how many of them lie within maxDistance of queryEmbedding.
+// Versions without reviews are reported with zero counts, in the order
+// given.
+func (r *postgresRepository) VersionTopicStats(ctx context.Context, queryEmbedding []float32, model, appID string, versions []string, maxDistance float64) ([]types.VersionTopicStats, error) {
+	present, err := r.hasVersionColumn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		return nil, ErrNoVersionColumn
+	}
+
+	args := []any{pgvector.NewVector(queryEmbedding), appID, maxDistance, versions}
+	source, args := embeddingSource(model, "$2", args)
+
+	query := fmt.Sprintf(`
+		SELECT
+			v.version,
+			COUNT(cr.id) FILTER (WHERE re.content_vec <=> $1 <= $3) AS matching,
+			COUNT(cr.id) AS total,
+			COALESCE(AVG(cr.rating) FILTER (WHERE re.content_vec <=> $1 <= $3), 0)::float8 AS matching_rating,
+			COALESCE(AVG(cr.rating), 0)::float8 AS average_rating
+		FROM unnest($4::text[]) WITH ORDINALITY AS v(version, position)
+		LEFT JOIN (
+			clean_reviews cr JOIN %[2]s re ON re.review_id = cr.id
+		) ON cr.app_id = $2 AND cr.%[1]s = v.version
+		GROUP BY v.version, v.position
+		ORDER BY v.position;
+	`, versionColumn, source)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute version topic query: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []types.VersionTopicStats
+	for rows.Next() {
+		var stat types.VersionTopicStats
+		if err := rows.Scan(&stat.Version, &stat.Matching, &stat.Total, &stat.MatchingRating, &stat.AverageRating); err != nil {
+			return nil, fmt.Errorf("failed to scan version topic stats: %w", err)
+		}
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return stats, nil
+}
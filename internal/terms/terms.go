@@ -0,0 +1,65 @@
+// Package terms splits text into the words that matter when comparing or
+// summarising reviews, shared by theme extraction and lexical reranking.
+package terms
+
+import (
+	"strings"
+	"unicode"
+)
+
+var stopwords = map[string]struct{}{
+	"a": {}, "about": {}, "after": {}, "again": {}, "all": {}, "also": {}, "an": {}, "and": {},
+	"any": {}, "app": {}, "apps": {}, "are": {}, "as": {}, "at": {}, "be": {}, "because": {},
+	"been": {}, "before": {}, "but": {}, "by": {}, "can": {}, "cant": {}, "could": {}, "did": {},
+	"didnt": {}, "do": {}, "does": {}, "doesnt": {}, "dont": {}, "even": {}, "every": {}, "for": {},
+	"from": {}, "get": {}, "got": {}, "had": {}, "has": {}, "have": {}, "how": {}, "i": {},
+	"in": {}, "into": {}, "is": {}, "isnt": {}, "it": {}, "its": {}, "just": {}, "like": {},
+	"more": {}, "most": {}, "much": {}, "not": {}, "now": {}, "of": {}, "on": {}, "one": {},
+	"only": {}, "or": {}, "other": {}, "our": {}, "out": {}, "over": {}, "please": {}, "really": {},
+	"say": {}, "should": {}, "some": {}, "still": {}, "than": {}, "that": {}, "the": {}, "their": {},
+	"them": {}, "then": {}, "there": {}, "these": {}, "they": {}, "thing": {}, "this": {}, "time": {},
+	"to": {}, "too": {}, "use": {}, "users": {}, "using": {}, "very": {}, "was": {}, "way": {},
+	"were": {}, "what": {}, "when": {}, "which": {}, "while": {}, "who": {}, "why": {}, "will": {},
+	"with": {}, "wont": {}, "would": {}, "you": {}, "your": {},
+}
+
+// Options tune Extract for its caller.
+type Options struct {
+	// MinLength drops words shorter than this many characters.
+	MinLength int
+	// KeepSymbols keeps dots and dashes inside words so that version
+	// numbers and error codes stay intact.
+	KeepSymbols bool
+}
+
+// Extract lowercases text and returns its distinct words in order of first
+// appearance, without stopwords. Apostrophes are dropped so that "don't"
+// and "dont" are the same word.
+func Extract(text string, opts Options) []string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(text))
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		if opts.KeepSymbols && (r == '.' || r == '-') {
+			return false
+		}
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(fields))
+	result := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.Trim(field, ".-")
+		if field == "" || len([]rune(field)) < opts.MinLength {
+			continue
+		}
+		if _, ok := stopwords[field]; ok {
+			continue
+		}
+		if _, ok := seen[field]; ok {
+			continue
+		}
+		seen[field] = struct{}{}
+		result = append(result, field)
+	}
+
+	return result
+}
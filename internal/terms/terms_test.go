@@ -0,0 +1,21 @@
+package terms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	themes := Options{MinLength: 3}
+	assert.Equal(t,
+		[]string{"onboarding", "confusing", "tutorial", "let", "skip"},
+		Extract("The onboarding is confusing, and the tutorial won't let me skip. Onboarding!", themes),
+	)
+	assert.Equal(t, []string{"make", "sign"}, Extract("Don't make me sign up", themes))
+
+	assert.Equal(t,
+		[]string{"crash", "v2.3.1", "error", "e-1234"},
+		Extract("Why does the app crash on v2.3.1? Error... E-1234, crash!", Options{KeepSymbols: true}),
+	)
+}
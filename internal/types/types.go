@@ -2,9 +2,76 @@ package types
 
 import "time"
 
+const (
+	RetrievalModeVector = "vector"
+	RetrievalModeHybrid = "hybrid"
+)
+
+// RAGQuery is a question about the reviews of one app (AppID) or several
+// (AppIDs). Mode and MMRLambda override the service defaults; MMRLambda
+// trades relevance (1) against diversity of the returned reviews, and 1
+// disables diversification. Themes asks for the retrieved reviews to be
+// grouped into themes, ByVersion for a breakdown by app version.
 type RAGQuery struct {
-	Query string `json:"query" validate:"required,max=1000"`
-	AppID string `json:"appId" validate:"required"`
+	Query     string      `json:"query" validate:"required,max=1000"`
+	AppID     string      `json:"appId,omitempty" validate:"required_without=AppIDs"`
+	AppIDs    []string    `json:"appIds,omitempty" validate:"omitempty,max=20,dive,required"`
+	Filters   *RAGFilters `json:"filters,omitempty" validate:"omitempty"`
+	Mode      string      `json:"mode,omitempty" validate:"omitempty,oneof=vector hybrid"`
+	MMRLambda *float64    `json:"mmrLambda,omitempty" validate:"omitempty,gt=0,max=1"`
+	Themes    bool        `json:"themes,omitempty"`
+	ByVersion bool        `json:"groupByVersion,omitempty"`
+}
+
+// Apps returns the apps the query covers: AppID followed by AppIDs, without
+// duplicates.
+func (q RAGQuery) Apps() []string {
+	apps := make([]string, 0, len(q.AppIDs)+1)
+	seen := make(map[string]bool, len(q.AppIDs)+1)
+	for _, app := range append([]string{q.AppID}, q.AppIDs...) {
+		if app == "" || seen[app] {
+			continue
+		}
+		seen[app] = true
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+type RAGBatchRequest struct {
+	Queries []RAGQuery `json:"queries" validate:"required,min=1,max=200"`
+	// RetrievalOnly skips answer generation: each result has the retrieved
+	// reviews and confidence but no answer.
+	RetrievalOnly bool `json:"retrievalOnly,omitempty"`
+}
+
+// RAGBatchItem is the outcome of one query of a batch: either Response or Error is set.
+type RAGBatchItem struct {
+	Index    int          `json:"index"`
+	Response *RAGResponse `json:"response,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+type RAGBatchResponse struct {
+	Results        []RAGBatchItem `json:"results"`
+	Succeeded      int            `json:"succeeded"`
+	Failed         int            `json:"failed"`
+	ProcessingTime float64        `json:"processingTime"`
+}
+
+// RAGFilters restricts retrieval by review metadata. Zero values mean "no
+// restriction". Countries and languages are matched case-insensitively;
+// LastDays is an alternative to From. Versions match the app version
+// exactly and need an app_version column in clean_reviews.
+type RAGFilters struct {
+	MinRating int16     `json:"minRating,omitempty" validate:"omitempty,min=1,max=5"`
+	MaxRating int16     `json:"maxRating,omitempty" validate:"omitempty,min=1,max=5,gtefield=MinRating"`
+	Countries []string  `json:"countries,omitempty" validate:"omitempty,max=50,dive,len=2,alpha"`
+	Languages []string  `json:"languages,omitempty" validate:"omitempty,max=50,dive,min=2,max=10"`
+	From      time.Time `json:"from,omitzero"`
+	To        time.Time `json:"to,omitzero" validate:"omitempty,gtfield=From"`
+	LastDays  int       `json:"lastDays,omitempty" validate:"omitempty,min=1,max=3650,excluded_with=From"`
+	Versions  []string  `json:"versions,omitempty" validate:"omitempty,max=50,dive,required,max=50"`
 }
 
 type RetrievedReview struct {
@@ -16,24 +83,235 @@ type RetrievedReview struct {
 	Rating          int16     `json:"rating"`
 	Country         string    `json:"country"`
 	Language        string    `json:"language"`
+	AppVersion      string    `json:"app_version,omitempty"`
 	Date            time.Time `json:"date"`
 	Distance        float64   `json:"distance"`
 	Similarity      float64   `json:"similarity"`
+	RerankScore     float64   `json:"rerank_score,omitempty"`
+	Embedding       []float32 `json:"-"`
 }
 
 type RAGResponse struct {
-	Answer           string            `json:"answer"`
-	RetrievedReviews []RetrievedReview `json:"retrievedReviews"`
-	Confidence       float64           `json:"confidence"`
-	ProcessingTime   float64           `json:"processingTime"`
-	QueryHash        string            `json:"queryHash"`
+	Answer              string             `json:"answer"`
+	Citations           []Citation         `json:"citations"`
+	UnverifiedCitations []string           `json:"unverifiedCitations,omitempty"`
+	RetrievedReviews    []RetrievedReview  `json:"retrievedReviews"`
+	Confidence          float64            `json:"confidence"`
+	ProcessingTime      float64            `json:"processingTime"`
+	QueryHash           string             `json:"queryHash"`
+	Apps                []AppBreakdown     `json:"apps,omitempty"`
+	Themes              []Theme            `json:"themes,omitempty"`
+	Versions            []VersionBreakdown `json:"versions,omitempty"`
+}
+
+// AppBreakdown summarises the retrieved reviews of one app of a multi-app
+// query. TopReviewIDs are the app's reviews in ranking order.
+type AppBreakdown struct {
+	AppID         string   `json:"appId"`
+	ReviewCount   int      `json:"reviewCount"`
+	AverageRating float64  `json:"averageRating"`
+	TopReviewIDs  []string `json:"topReviewIds"`
+}
+
+// CompareRequest asks the same question about two or more apps, typically
+// our app and its competitors.
+type CompareRequest struct {
+	Query   string      `json:"query" validate:"required,max=1000"`
+	AppIDs  []string    `json:"appIds" validate:"required,min=2,max=5,unique,dive,required"`
+	Filters *RAGFilters `json:"filters,omitempty" validate:"omitempty"`
+}
+
+// CompareResponse is a side-by-side answer; Apps follows the order of the
+// request's AppIDs.
+type CompareResponse struct {
+	Answer              string          `json:"answer"`
+	Citations           []Citation      `json:"citations"`
+	UnverifiedCitations []string        `json:"unverifiedCitations,omitempty"`
+	Apps                []AppComparison `json:"apps"`
+	Confidence          float64         `json:"confidence"`
+	ProcessingTime      float64         `json:"processingTime"`
+	QueryHash           string          `json:"queryHash"`
+}
+
+// AppComparison describes one app's reviews on the compared topic.
+// Sentiment is positive, negative or mixed depending on the shares of 4-5
+// and 1-2 star reviews, or unknown when the app has none.
+// DistinctThemes are terms its reviews mention noticeably more often than
+// the other apps' reviews.
+type AppComparison struct {
+	AppID                 string            `json:"appId"`
+	ReviewCount           int               `json:"reviewCount"`
+	AverageRating         float64           `json:"averageRating"`
+	Sentiment             string            `json:"sentiment"`
+	PositiveShare         float64           `json:"positiveShare"`
+	NegativeShare         float64           `json:"negativeShare"`
+	RepresentativeReviews []RetrievedReview `json:"representativeReviews"`
+	DistinctThemes        []string          `json:"distinctThemes"`
+}
+
+// ThemesQuery selects the reviews clustered by GET /apps/{appId}/themes.
+// K is the number of themes, chosen from the review count when zero;
+// LastDays limits the reviews to a recent window.
+type ThemesQuery struct {
+	AppID    string `validate:"required"`
+	K        int    `validate:"omitempty,min=2,max=30"`
+	LastDays int    `validate:"omitempty,min=1,max=3650"`
+}
+
+type ThemesResponse struct {
+	AppID          string  `json:"appId"`
+	ReviewCount    int     `json:"reviewCount"`
+	Themes         []Theme `json:"themes"`
+	ProcessingTime float64 `json:"processingTime"`
+}
+
+// Theme is a cluster of reviews with similar embeddings. Label is built
+// from Keywords, the terms that set the theme apart from the others;
+// RepresentativeReviews are the reviews closest to its centre.
+type Theme struct {
+	Label                 string            `json:"label"`
+	Keywords              []string          `json:"keywords"`
+	Size                  int               `json:"size"`
+	Share                 float64           `json:"share"`
+	AverageRating         float64           `json:"averageRating"`
+	RepresentativeReviews []RetrievedReview `json:"representativeReviews"`
+	Trend                 []ThemePeriod     `json:"trend,omitempty"`
+}
+
+// ThemePeriod counts a theme's reviews in one calendar month (UTC). Share
+// is relative to all clustered reviews of that month, so it shows whether
+// the theme grows independently of review volume.
+type ThemePeriod struct {
+	Month string  `json:"month"`
+	Count int     `json:"count"`
+	Share float64 `json:"share"`
+}
+
+// TrendRequest asks how often reviews about a topic came up over time.
+// A review matches when its similarity to Query is at least MinSimilarity,
+// which defaults to the service setting. Without a lower date bound in
+// Filters the last 180 days are covered.
+type TrendRequest struct {
+	Query         string      `json:"query" validate:"required,max=1000"`
+	AppID         string      `json:"appId" validate:"required"`
+	Interval      string      `json:"interval,omitempty" validate:"omitempty,oneof=week month"`
+	MinSimilarity float64     `json:"minSimilarity,omitempty" validate:"omitempty,gt=0,lt=1"`
+	Filters       *RAGFilters `json:"filters,omitempty" validate:"omitempty"`
+}
+
+type TrendResponse struct {
+	AppID          string        `json:"appId"`
+	Interval       string        `json:"interval"`
+	MinSimilarity  float64       `json:"minSimilarity"`
+	Buckets        []TrendBucket `json:"buckets"`
+	ProcessingTime float64       `json:"processingTime"`
+	QueryHash      string        `json:"queryHash"`
+}
+
+// TrendBucket is one week or month of a trend. Matching counts the reviews
+// about the topic out of Total reviews; AverageRating is over the matching
+// ones. Anomaly marks a spike in Matching, ZScore standard deviations above
+// the preceding buckets.
+type TrendBucket struct {
+	Start         time.Time `json:"start"`
+	Matching      int       `json:"matching"`
+	Total         int       `json:"total"`
+	Share         float64   `json:"share"`
+	AverageRating float64   `json:"averageRating"`
+	ZScore        float64   `json:"zScore"`
+	Anomaly       bool      `json:"anomaly"`
+}
+
+// RegressionRequest compares how much of an app's feedback is about a topic
+// in two releases. MinSimilarity works as in TrendRequest.
+type RegressionRequest struct {
+	Query         string  `json:"query" validate:"required,max=1000"`
+	AppID         string  `json:"appId" validate:"required"`
+	BaseVersion   string  `json:"baseVersion" validate:"required,max=50"`
+	TargetVersion string  `json:"targetVersion" validate:"required,max=50,nefield=BaseVersion"`
+	MinSimilarity float64 `json:"minSimilarity,omitempty" validate:"omitempty,gt=0,lt=1"`
+}
+
+// RegressionResponse reports the topic's share of reviews in both versions.
+// ZScore comes from a two-proportion test of the shares; Regression is set
+// when the target version's share is significantly higher. Reviews are the
+// target version's reviews closest to the topic.
+type RegressionResponse struct {
+	AppID          string            `json:"appId"`
+	MinSimilarity  float64           `json:"minSimilarity"`
+	Base           VersionTopicStats `json:"base"`
+	Target         VersionTopicStats `json:"target"`
+	ShareChange    float64           `json:"shareChange"`
+	ZScore         float64           `json:"zScore"`
+	Regression     bool              `json:"regression"`
+	Reviews        []RetrievedReview `json:"reviews"`
+	ProcessingTime float64           `json:"processingTime"`
+	QueryHash      string            `json:"queryHash"`
+}
+
+// VersionTopicStats counts one version's reviews and those matching a topic.
+// MatchingRating averages the matching reviews, AverageRating all of them.
+type VersionTopicStats struct {
+	Version        string  `json:"version"`
+	Matching       int     `json:"matching"`
+	Total          int     `json:"total"`
+	Share          float64 `json:"share"`
+	MatchingRating float64 `json:"matchingRating"`
+	AverageRating  float64 `json:"averageRating"`
+}
+
+// VersionBreakdown summarises the retrieved reviews of one app version.
+type VersionBreakdown struct {
+	Version       string   `json:"version"`
+	ReviewCount   int      `json:"reviewCount"`
+	AverageRating float64  `json:"averageRating"`
+	TopReviewIDs  []string `json:"topReviewIds"`
+}
+
+// RAGStreamDone is the final event of a streamed query. Tokens streamed before
+// it are raw model output; Answer is the cleaned answer the citations refer to.
+type RAGStreamDone struct {
+	Answer              string     `json:"answer"`
+	Citations           []Citation `json:"citations"`
+	UnverifiedCitations []string   `json:"unverifiedCitations,omitempty"`
+	Confidence          float64    `json:"confidence"`
+	ProcessingTime      float64    `json:"processingTime"`
+	QueryHash           string     `json:"queryHash"`
 }
 
+// Citation links a span of the answer, given as character offsets, to the
+// retrieved reviews that support it.
+type Citation struct {
+	Start     int      `json:"start"`
+	End       int      `json:"end"`
+	Text      string   `json:"text"`
+	ReviewIDs []string `json:"reviewIds"`
+}
+
+// EmbeddingRequest.Input is either a single string or a list of strings.
 type EmbeddingRequest struct {
-	Input string `json:"input"`
+	Input any    `json:"input"`
 	Model string `json:"model"`
 }
 
+// OllamaEmbeddingRequest is the body of Ollama's /api/embeddings, which
+// embeds one prompt per call.
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+// TEIEmbedRequest is the body of text-embeddings-inference's /embed. The
+// response is a bare list of embeddings in input order.
+type TEIEmbedRequest struct {
+	Inputs   []string `json:"inputs"`
+	Truncate bool     `json:"truncate"`
+}
+
 type EmbeddingResponse struct {
 	Data []struct {
 		Embedding []float32 `json:"embedding"`
@@ -47,6 +325,24 @@ type EmbeddingResponse struct {
 	} `json:"usage"`
 }
 
+// EmbeddingMigrationStatus reports the backfill of shadow embeddings for a
+// new model and whether retrieval has moved over to them.
+type EmbeddingMigrationStatus struct {
+	Model    string                 `json:"model"`
+	Active   bool                   `json:"active"`
+	Total    int                    `json:"total"`
+	Embedded int                    `json:"embedded"`
+	Coverage float64                `json:"coverage"`
+	Apps     []AppEmbeddingCoverage `json:"apps"`
+}
+
+type AppEmbeddingCoverage struct {
+	AppID    string  `json:"appId"`
+	Total    int     `json:"total"`
+	Embedded int     `json:"embedded"`
+	Coverage float64 `json:"coverage"`
+}
+
 type HealthResponse struct {
 	Status    string            `json:"status"`
 	Timestamp time.Time         `json:"timestamp"`
@@ -65,3 +361,74 @@ type EmbeddingHealth struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
 }
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+	Stream      bool          `json:"stream,omitempty"`
+}
+
+type ChatCompletionResponse struct {
+	Choices []struct {
+		Index        int         `json:"index"`
+		Message      ChatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type ChatCompletionChunk struct {
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+type RerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+type RerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// TEIRerankRequest is the body of text-embeddings-inference's /rerank. The
+// response is a bare list of TEIRerankResult, best first.
+type TEIRerankRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type TEIRerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// Metric is one rolled-up aggregate; a nil AppID denotes a global metric.
+type Metric struct {
+	Name  string
+	Value float64
+	AppID *string
+}
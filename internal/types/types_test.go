@@ -0,0 +1,78 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRAGQuery_FilterValidation(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		filters *RAGFilters
+		valid   bool
+	}{
+		{"no filters", nil, true},
+		{"empty filters", &RAGFilters{}, true},
+		{"rating range", &RAGFilters{MinRating: 1, MaxRating: 2}, true},
+		{"min rating only", &RAGFilters{MinRating: 4}, true},
+		{"max rating only", &RAGFilters{MaxRating: 2}, true},
+		{"rating out of range", &RAGFilters{MinRating: 6}, false},
+		{"inverted rating range", &RAGFilters{MinRating: 4, MaxRating: 2}, false},
+		{"countries", &RAGFilters{Countries: []string{"de", "US"}}, true},
+		{"invalid country", &RAGFilters{Countries: []string{"deu"}}, false},
+		{"languages", &RAGFilters{Languages: []string{"de", "pt-BR"}}, true},
+		{"invalid language", &RAGFilters{Languages: []string{"x"}}, false},
+		{"date range", &RAGFilters{From: now.AddDate(0, -1, 0), To: now}, true},
+		{"to only", &RAGFilters{To: now}, true},
+		{"inverted date range", &RAGFilters{From: now, To: now.AddDate(0, -1, 0)}, false},
+		{"last days", &RAGFilters{LastDays: 30}, true},
+		{"last days with from", &RAGFilters{LastDays: 30, From: now}, false},
+		{"last days with to", &RAGFilters{LastDays: 30, To: now}, true},
+		{"combined", &RAGFilters{MinRating: 1, MaxRating: 2, Countries: []string{"de"}, LastDays: 30}, true},
+	}
+
+	validate := validator.New()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Struct(RAGQuery{Query: "login", AppID: "app", Filters: tt.filters})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRAGQuery_MMRLambdaValidation(t *testing.T) {
+	validate := validator.New()
+	lambda := func(v float64) *float64 { return &v }
+
+	assert.NoError(t, validate.Struct(RAGQuery{Query: "q", AppID: "app"}))
+	assert.NoError(t, validate.Struct(RAGQuery{Query: "q", AppID: "app", MMRLambda: lambda(0.5)}))
+	assert.NoError(t, validate.Struct(RAGQuery{Query: "q", AppID: "app", MMRLambda: lambda(1)}))
+	assert.Error(t, validate.Struct(RAGQuery{Query: "q", AppID: "app", MMRLambda: lambda(0)}))
+	assert.Error(t, validate.Struct(RAGQuery{Query: "q", AppID: "app", MMRLambda: lambda(1.5)}))
+}
+
+func TestRAGQuery_AppsValidation(t *testing.T) {
+	validate := validator.New()
+
+	assert.NoError(t, validate.Struct(RAGQuery{Query: "q", AppIDs: []string{"a", "b"}}))
+	assert.NoError(t, validate.Struct(RAGQuery{Query: "q", AppID: "a", AppIDs: []string{"b"}}))
+	assert.Error(t, validate.Struct(RAGQuery{Query: "q"}))
+	assert.Error(t, validate.Struct(RAGQuery{Query: "q", AppIDs: []string{"a", ""}}))
+	assert.Error(t, validate.Struct(RAGQuery{Query: "q", AppIDs: make([]string, 21)}))
+}
+
+func TestRAGQuery_Apps(t *testing.T) {
+	assert.Equal(t, []string{"a"}, RAGQuery{AppID: "a"}.Apps())
+	assert.Equal(t, []string{"a", "b", "c"}, RAGQuery{AppID: "a", AppIDs: []string{"b", "a", "c", "b"}}.Apps())
+	assert.Equal(t, []string{"b"}, RAGQuery{AppIDs: []string{"b"}}.Apps())
+}